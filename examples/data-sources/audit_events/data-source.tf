@@ -0,0 +1,9 @@
+data "shoreline_audit_events" "bot_changes" {
+  object_type = "bot"
+  since       = "2021-07-01T00:00:00Z"
+  limit       = 100
+}
+
+output "bot_changes_by" {
+  value = distinct([for e in data.shoreline_audit_events.bot_changes.events : e.actor])
+}
@@ -25,6 +25,9 @@
 #     # Destination of the memory-check, and trace scripts on the selected resources:
 #     script_path = "/agent/scripts"
 #   }
+#
+# The same objects are also packaged as a manifest (pack/manifest.json),
+# to install them together with a single shoreline_op_pack resource.
 
 ################################################################################
 
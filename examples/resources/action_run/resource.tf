@@ -0,0 +1,16 @@
+resource "shoreline_action_run" "warm_cache" {
+  action_name    = shoreline_action.warm_cache.name
+  resource_query = "pods | app = \"web\""
+  params = {
+    CACHE_SIZE = "512"
+  }
+  # run again on each new release
+  triggers = {
+    release = var.release
+  }
+  fail_on_error = true
+}
+
+output "warm_cache_output" {
+  value = { for r in shoreline_action_run.warm_cache.results : r.resource_name => r.stdout }
+}
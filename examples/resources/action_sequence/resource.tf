@@ -0,0 +1,9 @@
+resource "shoreline_action_sequence" "disk_cleanup" {
+  name        = "disk_cleanup"
+  description = "Check disk usage, then clean up old files."
+  steps = [
+    shoreline_action.check_disk.name,
+    "${shoreline_action.clean_tmp.name}(days=\"7\")",
+  ]
+  stop_on_failure = true
+}
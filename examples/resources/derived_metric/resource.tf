@@ -0,0 +1,8 @@
+resource "shoreline_derived_metric" "cpu_per_core" {
+  name          = "cpu_per_core"
+  input_metrics = [shoreline_metric.cpu_usage.name, shoreline_metric.cpu_count.name]
+  expression    = "cpu_usage / cpu_count"
+  description   = "CPU usage per core."
+  units         = "percent"
+  resource_type = "HOST"
+}
@@ -0,0 +1,12 @@
+resource "shoreline_bot" "cpu_bot" {
+  name    = "cpu_bot"
+  command = "if ${shoreline_alarm.cpu_alarm.name} then ${shoreline_action.ls_action.name}('/tmp') fi"
+
+  # enabled is left unset, as it's owned by shoreline_enablement.cpu_bot
+}
+
+resource "shoreline_enablement" "cpu_bot" {
+  object_type = "bot"
+  object_name = shoreline_bot.cpu_bot.name
+  enabled     = true
+}
@@ -0,0 +1,10 @@
+
+# Distribute a generated config file, without writing it to disk first.
+resource "shoreline_file" "app_config" {
+  name             = "app_config"
+  content          = templatefile("${path.module}/app.conf.tpl", { port = 8080 }) # or content_base64 for binary data
+  destination_path = "/etc/app/app.conf"
+  resource_query   = "host"
+  description      = "Per-environment app config."
+  enabled          = true
+}
@@ -0,0 +1,31 @@
+
+# Distribute the whole JVM tooling directory (scripts and jars) as a single tarball.
+resource "shoreline_file" "jvm_tools" {
+  name             = "jvm_tools"
+  source_dir       = "${path.module}/../data/jvm_tools" # packed as a tarball
+  include          = ["*.sh", "*.jar"]                  # (optional) which files to pack
+  exclude          = ["tmp"]                            # (optional) files or directories to leave out
+  destination_path = "/agent/scripts/jvm_tools.tar"     # where the tarball is copied on the selected resources
+  resource_query   = "host"
+  description      = "JVM debugging tools."
+  enabled          = true
+}
+
+# Extract the tarball on the resources.
+resource "shoreline_action" "jvm_tools_extract" {
+  name           = "jvm_tools_extract"
+  command        = "`mkdir -p /agent/scripts/jvm_tools && tar -xf /agent/scripts/jvm_tools.tar -C /agent/scripts/jvm_tools`"
+  resource_query = "host"
+  file_deps      = [shoreline_file.jvm_tools.name]
+  enabled        = true
+}
+
+# Run the extraction again whenever the packed files change.
+resource "shoreline_action_run" "jvm_tools_extract" {
+  action_name    = shoreline_action.jvm_tools_extract.name
+  resource_query = "host"
+  triggers = {
+    checksum = shoreline_file.jvm_tools.checksum
+  }
+  fail_on_error = true
+}
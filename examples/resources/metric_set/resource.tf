@@ -0,0 +1,6 @@
+resource "shoreline_metric_set" "host_cpu" {
+  name          = "host_cpu"
+  metrics       = [shoreline_metric.cpu_usage.name, shoreline_derived_metric.cpu_per_core.name]
+  resource_type = "HOST"
+  description   = "Host CPU dashboard metrics."
+}
@@ -0,0 +1,15 @@
+resource "shoreline_notebook_run" "rotate_logs" {
+  notebook_name = shoreline_notebook.rotate_logs.name
+  params = {
+    APP = "web"
+  }
+  # run again on each new release
+  triggers = {
+    release = var.release
+  }
+  fail_on_error = true
+
+  timeouts {
+    create = "30m"
+  }
+}
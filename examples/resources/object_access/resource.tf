@@ -0,0 +1,8 @@
+# Owned by the security team, while the app team owns the notebook definition
+# (which has: lifecycle { ignore_changes = [approvers] }).
+resource "shoreline_object_access" "restart_approvers" {
+  object_type = "notebook"
+  object_name = shoreline_notebook.restart_pods.name
+  list        = "approvers"
+  entities    = ["sre_oncall", "alice@example.com"]
+}
@@ -0,0 +1,9 @@
+resource "shoreline_op_pack" "jvm_trace" {
+  name       = "jvm_trace"
+  source_dir = "${path.module}/op_packs/jvm_trace/pack"
+  variables = {
+    namespace         = "jvm_trace"
+    resource_query    = "jvm_pods"
+    jvm_process_regex = "tomcat"
+  }
+}
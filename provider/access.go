@@ -0,0 +1,319 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// shoreline_object_access adds entities (users or principals) to an access list of an object
+// defined elsewhere (e.g. a notebook's "approvers"), so that access can be owned separately
+// from the definition. Each resource only adds and removes its own entities, and only writes
+// back the list it manages, so several resources can share a list.
+// The read-modify-write of a list is only serialized within the provider process (i.e. one
+// Terraform run). The backend has no compare-and-set for lists, so runs of different
+// workspaces (or states) that change the same list at the same time can lose each other's
+// entries; these show up as a diff on the next plan of the workspace that added them.
+
+// The attributes that hold access lists.
+var accessListAttrs = []string{"allowed_entities", "approvers"}
+
+// The order to write an object's access lists in.
+// XXX Hack: works around a backend issue with data-dependent ordering of the two.
+func accessListOrder(hasAllowedEntities bool) []string {
+	if hasAllowedEntities {
+		return []string{"allowed_entities", "approvers"}
+	}
+	return []string{"approvers", "allowed_entities"}
+}
+
+// The access lists of each object type (from the definitions) that has any.
+func accessListObjectTypes(objects map[string]interface{}) map[string][]string {
+	types := map[string][]string{}
+	for typ, object := range objects {
+		if typ == "docs" {
+			continue
+		}
+		for _, list := range accessListAttrs {
+			if GetNestedValueOrDefault(object, ToKeyPath("attributes."+list), nil) != nil {
+				types[typ] = append(types[typ], list)
+			}
+		}
+	}
+	return types
+}
+
+// Adds 'add' to and removes 'remove' from a list, keeping the order of the other entries.
+func UpdateAccessList(current []interface{}, add []interface{}, remove []interface{}) []interface{} {
+	drop := map[string]bool{}
+	for _, e := range remove {
+		drop[CastToString(e)] = true
+	}
+	present := map[string]bool{}
+	out := []interface{}{}
+	for _, e := range current {
+		if drop[CastToString(e)] || present[CastToString(e)] {
+			continue
+		}
+		present[CastToString(e)] = true
+		out = append(out, CastToString(e))
+	}
+	for _, e := range add {
+		if !present[CastToString(e)] {
+			present[CastToString(e)] = true
+			out = append(out, CastToString(e))
+		}
+	}
+	return out
+}
+
+// Serializes the read-modify-write of an object's access lists across the resources of this
+// process. Other processes (e.g. other workspaces) are not covered.
+var accessLocks = struct {
+	sync.Mutex
+	objects map[string]*sync.Mutex
+}{objects: map[string]*sync.Mutex{}}
+
+func lockObjectAccess(typ string, name string) func() {
+	accessLocks.Lock()
+	lock, exists := accessLocks.objects[typ+":"+name]
+	if !exists {
+		lock = &sync.Mutex{}
+		accessLocks.objects[typ+":"+name] = lock
+	}
+	accessLocks.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+func resourceShorelineObjectAccess(configJsStr string) *schema.Resource {
+	objects := map[string]interface{}{}
+	json.Unmarshal([]byte(configJsStr), &objects)
+	access := &objectAccess{objects: objects, lists: accessListObjectTypes(objects)}
+
+	types := []string{}
+	for typ, _ := range access.lists {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	return &schema.Resource{
+		Description: "Shoreline object access. Adds users or principals to an access list (`allowed_entities` or `approvers`) of an object that is defined elsewhere.\n\n" +
+			"Entities are added without removing the others, so several resources (e.g. of different teams) can share a list, as long as they don't add the same entities. " +
+			"To avoid conflicts, the resource that defines the object should ignore the list, e.g. `lifecycle { ignore_changes = [approvers] }`.\n\n" +
+			"~> Changes are a read-modify-write of the list, which is only serialized within one Terraform run. " +
+			"Applying resources that change the same list from different workspaces (or states) at the same time is not safe: one run can overwrite the entries added by the other. " +
+			"Lost entries show up as a diff on the next plan of the workspace that added them.",
+
+		CreateContext: access.create,
+		ReadContext:   access.read,
+		UpdateContext: access.update,
+		DeleteContext: access.delete,
+		Importer:      &schema.ResourceImporter{StateContext: resourceShorelineObjectAccessImport},
+
+		Schema: map[string]*schema.Schema{
+			"object_type": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					if _, known := access.lists[val.(string)]; !known {
+						errs = append(errs, fmt.Errorf("%q must be one of (%s),\n but got: %s", key, strings.Join(types, ", "), val.(string)))
+					}
+					return
+				},
+				Description: "The type of the object, one of: " + strings.Join(types, ", ") + ".",
+			},
+			"object_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					if !ValidateVariableName(val.(string)) {
+						errs = append(errs, fmt.Errorf("%q must be a valid object name (^[_a-zA-Z][_a-zA-Z0-9]*$),\n but got: %s", key, val.(string)))
+					}
+					return
+				},
+				Description: "The name of the object.",
+			},
+			"list": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					for _, list := range accessListAttrs {
+						if val.(string) == list {
+							return
+						}
+					}
+					errs = append(errs, fmt.Errorf("%q must be one of (%s),\n but got: %s", key, strings.Join(accessListAttrs, ", "), val.(string)))
+					return
+				},
+				Description: "The access list to add to: `allowed_entities` (who can run the object) or `approvers` (who approves its runs, notebooks only).",
+			},
+			"entities": {
+				Type:        schema.TypeSet,
+				Required:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The users or principals to add.",
+			},
+		},
+	}
+}
+
+type objectAccess struct {
+	objects map[string]interface{}
+	lists   map[string][]string
+}
+
+func (a *objectAccess) attrs(typ string) map[string]interface{} {
+	attrs, _ := GetNestedValueOrDefault(a.objects, ToKeyPath(typ+".attributes"), map[string]interface{}{}).(map[string]interface{})
+	return attrs
+}
+
+// Reads the object's current access lists (fresh from the backend).
+func (a *objectAccess) readLists(meta interface{}, typ string, name string) (map[string][]interface{}, diag.Diagnostics) {
+	invalidateCachedObject(meta, typ, name)
+	record, stepsJs, diags := readShorelineObjectRecord(meta, typ, name)
+	if diags != nil {
+		return nil, diags
+	}
+	lists := map[string][]interface{}{}
+	for _, list := range a.lists[typ] {
+		_, val, diags := resourceShorelineObjectReadSingleAttr(name, typ, list, a.attrs(typ), record, stepsJs, nil)
+		if diags != nil {
+			return nil, diags
+		}
+		lists[list] = CastToArray(val)
+	}
+	return lists, nil
+}
+
+// Adds and removes entities of one of the object's access lists, writing back only that list.
+func (a *objectAccess) change(meta interface{}, typ string, name string, list string, add []interface{}, remove []interface{}) diag.Diagnostics {
+	if !stringInList(list, a.lists[typ]) {
+		return diag.Errorf("%s objects have no '%s' access list", typ, list)
+	}
+	unlock := lockObjectAccess(typ, name)
+	defer unlock()
+
+	lists, diags := a.readLists(meta, typ, name)
+	if diags != nil {
+		return diags
+	}
+	updated := UpdateAccessList(lists[list], add, remove)
+	appendActionLog(fmt.Sprintf("Setting %s access: '%s'.'%s' to %v\n", typ, name, list, updated))
+	return setFieldKeepEnabled(meta, typ, a.attrs(typ), name, list, updated)
+}
+
+// Whether the object (still) exists, for when reading its lists fails.
+func (a *objectAccess) exists(meta interface{}, typ string, name string) bool {
+	names, err := listShorelineObjectNames(meta, typ)
+	return err != nil || stringInList(name, names)
+}
+
+func stringInList(val string, list []string) bool {
+	for _, v := range list {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+func objectAccessId(typ string, name string, list string, entities []interface{}) string {
+	names := []string{}
+	for _, e := range entities {
+		names = append(names, CastToString(e))
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%s:%s:%s:%s", typ, name, list, strings.Join(names, ","))
+}
+
+func (a *objectAccess) create(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	typ, name, list := d.Get("object_type").(string), d.Get("object_name").(string), d.Get("list").(string)
+	entities := d.Get("entities").(*schema.Set).List()
+	diags := a.change(meta, typ, name, list, entities, nil)
+	if diags != nil {
+		return diags
+	}
+	d.SetId(objectAccessId(typ, name, list, entities))
+	return a.read(ctx, d, meta)
+}
+
+// Keeps only the entities still on the list, so removed ones show up as a diff.
+// If the object is gone, so is the resource.
+func (a *objectAccess) read(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	typ, name, list := d.Get("object_type").(string), d.Get("object_name").(string), d.Get("list").(string)
+	appendActionLog(fmt.Sprintf("Reading %s access: '%s'.'%s'\n", typ, name, list))
+	lists, diags := a.readLists(meta, typ, name)
+	if diags != nil {
+		if !a.exists(meta, typ, name) {
+			appendActionLog(fmt.Sprintf("Removing %s access: '%s' no longer exists\n", typ, name))
+			d.SetId("")
+			return nil
+		}
+		return diags
+	}
+	onList := map[string]bool{}
+	for _, e := range lists[list] {
+		onList[CastToString(e)] = true
+	}
+	present := []interface{}{}
+	for _, e := range d.Get("entities").(*schema.Set).List() {
+		if onList[e.(string)] {
+			present = append(present, e)
+		}
+	}
+	d.Set("entities", present)
+	return nil
+}
+
+func (a *objectAccess) update(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	typ, name, list := d.Get("object_type").(string), d.Get("object_name").(string), d.Get("list").(string)
+	oldVal, nuVal := d.GetChange("entities")
+	old, nu := oldVal.(*schema.Set), nuVal.(*schema.Set)
+	diags := a.change(meta, typ, name, list, nu.Difference(old).List(), old.Difference(nu).List())
+	if diags != nil {
+		return diags
+	}
+	d.SetId(objectAccessId(typ, name, list, nu.List()))
+	return a.read(ctx, d, meta)
+}
+
+func (a *objectAccess) delete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	typ, name, list := d.Get("object_type").(string), d.Get("object_name").(string), d.Get("list").(string)
+	diags := a.change(meta, typ, name, list, nil, d.Get("entities").(*schema.Set).List())
+	if diags != nil && !a.exists(meta, typ, name) {
+		// nothing left to remove the entities from
+		return nil
+	}
+	return diags
+}
+
+// Imports from an id of the form "<object_type>:<object_name>:<list>:<entity>,<entity>,...".
+func resourceShorelineObjectAccessImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), ":", 4)
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("Object access id should be of the form '<object_type>:<object_name>:<list>:<entity>,...', but got: %s", d.Id())
+	}
+	entities := []interface{}{}
+	for _, e := range strings.Split(parts[3], ",") {
+		entities = append(entities, e)
+	}
+	d.Set("object_type", parts[0])
+	d.Set("object_name", parts[1])
+	d.Set("list", parts[2])
+	d.Set("entities", entities)
+	return []*schema.ResourceData{d}, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// shoreline_audit_events reads the audit trail of changes to objects:
+//   audit_events( object_type = "<type>", object_name = "<name>", user = "<user>", since = "<RFC3339>", until = "<RFC3339>" )
+//     -> audit_events.events[].{user, action, object_type, object_name, before, after, timestamp}
+// The filters are also applied to the result, so entries are exact whatever the backend supports.
+
+const auditEventsOpName = "audit_events"
+
+// The filters of the data source, by argument name.
+var auditEventFilters = []string{"object_type", "object_name", "user", "since", "until"}
+
+func auditEventsOp(filters map[string]string) string {
+	args := []string{}
+	for _, key := range auditEventFilters {
+		if val := filters[key]; val != "" {
+			args = append(args, fmt.Sprintf("%s = \"%s\"", key, EscapeString(val)))
+		}
+	}
+	return fmt.Sprintf("%s( %s )", auditEventsOpName, strings.Join(args, ", "))
+}
+
+// A before/after value as a JSON string ("" when missing).
+func auditValueString(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return ""
+	case string:
+		return val.(string)
+	}
+	js, err := json.Marshal(val)
+	if err != nil {
+		return CastToString(val)
+	}
+	return string(js)
+}
+
+// The matching events (oldest first), at most 'limit' of the newest ones when limit > 0.
+func ParseAuditEvents(js map[string]interface{}, filters map[string]string, limit int) ([]interface{}, error) {
+	var since, until time.Time
+	var err error
+	if filters["since"] != "" {
+		if since, err = time.Parse(time.RFC3339, filters["since"]); err != nil {
+			return nil, err
+		}
+	}
+	if filters["until"] != "" {
+		if until, err = time.Parse(time.RFC3339, filters["until"]); err != nil {
+			return nil, err
+		}
+	}
+
+	type event struct {
+		at  time.Time
+		val map[string]interface{}
+	}
+	events := []event{}
+	for _, e := range CastToArray(GetNestedValueOrDefault(js, ToKeyPath("audit_events.events"), []interface{}{})) {
+		entry := map[string]interface{}{
+			"actor":       CastToString(GetNestedValueOrDefault(e, ToKeyPath("user"), "")),
+			"action":      CastToString(GetNestedValueOrDefault(e, ToKeyPath("action"), "")),
+			"object_type": strings.ToLower(CastToString(GetNestedValueOrDefault(e, ToKeyPath("object_type"), ""))),
+			"object_name": CastToString(GetNestedValueOrDefault(e, ToKeyPath("object_name"), "")),
+			"before":      auditValueString(GetNestedValueOrDefault(e, ToKeyPath("before"), nil)),
+			"after":       auditValueString(GetNestedValueOrDefault(e, ToKeyPath("after"), nil)),
+			"timestamp":   CastToString(GetNestedValueOrDefault(e, ToKeyPath("timestamp"), "")),
+		}
+		at, err := time.Parse(time.RFC3339, entry["timestamp"].(string))
+		if err != nil {
+			return nil, fmt.Errorf("audit event has an invalid timestamp '%s'", entry["timestamp"])
+		}
+		entry["timestamp"] = at.UTC().Format(time.RFC3339)
+		if (filters["object_type"] != "" && entry["object_type"] != strings.ToLower(filters["object_type"])) ||
+			(filters["object_name"] != "" && entry["object_name"] != filters["object_name"]) ||
+			(filters["user"] != "" && entry["actor"] != filters["user"]) ||
+			(!since.IsZero() && at.Before(since)) ||
+			(!until.IsZero() && !at.Before(until)) {
+			continue
+		}
+		events = append(events, event{at: at, val: entry})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].at.Before(events[j].at)
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	out := []interface{}{}
+	for _, e := range events {
+		out = append(out, e.val)
+	}
+	return out, nil
+}
+
+func dataSourceShorelineAuditEvents() *schema.Resource {
+	eventAttr := func(typ schema.ValueType, description string) *schema.Schema {
+		return &schema.Schema{Type: typ, Computed: true, Description: description}
+	}
+	return &schema.Resource{
+		Description: "Shoreline audit events. The [audit trail](https://docs.shoreline.io/administration/audit) of changes to objects: who changed what, and when. " +
+			"Needs backend version " + opMinVersions[auditEventsOpName] + " or later.",
+
+		ReadContext: dataSourceShorelineAuditEventsRead,
+
+		Schema: map[string]*schema.Schema{
+			"object_type": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Only changes to objects of this type (e.g. `action`, `alarm` or `bot`).",
+			},
+			"object_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Only changes to the object with this name.",
+			},
+			"user": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Only changes made by this user.",
+			},
+			"since": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: ValidateTimestamp,
+				Description:  "Only changes at or after this time, as an RFC3339 timestamp.",
+			},
+			"until": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: ValidateTimestamp,
+				Description:  "Only changes before this time, as an RFC3339 timestamp.",
+			},
+			"limit": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+				Description: "Only the most recent changes, up to this many (0 for all).",
+			},
+			"events": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The matching changes, oldest first.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"actor":       eventAttr(schema.TypeString, "The user that made the change."),
+						"action":      eventAttr(schema.TypeString, "What was done (e.g. create, update or delete)."),
+						"object_type": eventAttr(schema.TypeString, "The type of the changed object."),
+						"object_name": eventAttr(schema.TypeString, "The name of the changed object."),
+						"before":      eventAttr(schema.TypeString, "The object's attributes before the change, as JSON (empty when created)."),
+						"after":       eventAttr(schema.TypeString, "The object's attributes after the change, as JSON (empty when deleted)."),
+						"timestamp":   eventAttr(schema.TypeString, "When the change was made, as an RFC3339 timestamp."),
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceShorelineAuditEventsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	filters := map[string]string{}
+	for _, key := range auditEventFilters {
+		filters[key] = d.Get(key).(string)
+	}
+	limit := d.Get("limit").(int)
+	if err := checkOpSupported(meta, auditEventsOpName, "Reading audit events"); err != nil {
+		return diag.FromErr(err)
+	}
+	op := auditEventsOp(filters)
+	appendActionLog(fmt.Sprintf("Reading audit events Op:'%s'\n", op))
+	js, err := runOpCommandToJson(op)
+	if err != nil {
+		return diag.Errorf("Failed to read audit events: %s", err.Error())
+	}
+	events, err := ParseAuditEvents(js, filters, limit)
+	if err != nil {
+		return diag.Errorf("Failed to read audit events: %s", err.Error())
+	}
+	if err := d.Set("events", events); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s|%d", op, limit)))))
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Per-run cache of remote objects, shared by all resources of a provider instance.
+//
+// On first use of an object type, one "list <type>s" and (for types with step classes)
+// one bulk "get_<type>_class()" are run in parallel, and all reads of that type are served
+// from the result. Writes invalidate the object, which is then fetched individually.
+// Objects missing from the cache (e.g. created outside of this run) are also fetched individually.
+
+type objectCacheEntry struct {
+	done    chan struct{}
+	err     error
+	records map[string]map[string]interface{}
+	classes map[string]map[string]interface{}
+}
+
+type objectCache struct {
+	sync.Mutex
+	types map[string]*objectCacheEntry
+	// "<type>:<name>" of objects written during this run
+	stale map[string]bool
+}
+
+func newObjectCache() *objectCache {
+	return &objectCache{
+		types: map[string]*objectCacheEntry{},
+		stale: map[string]bool{},
+	}
+}
+
+// The object types whose steps (e.g. templates) are only returned by get_<type>_class().
+func objectTypeHasClass(typ string) bool {
+	return typ == "alarm" || typ == "action" || typ == "bot" || typ == "integration" || typ == "notebook"
+}
+
+// Indexes the objects from a "list <type>s" result by name.
+func indexObjectRecords(js map[string]interface{}) map[string]map[string]interface{} {
+	records := map[string]map[string]interface{}{}
+	symbols, isArray := GetNestedValueOrDefault(js, ToKeyPath("list_type.symbol"), []interface{}{}).([]interface{})
+	if isArray {
+		for _, s := range symbols {
+			sName, isStr := GetNestedValueOrDefault(s, ToKeyPath("attributes.name"), "").(string)
+			sMap, isMap := s.(map[string]interface{})
+			if isStr && isMap {
+				records[sName] = sMap
+			}
+		}
+	}
+	return records
+}
+
+// Indexes the objects from a "get_<type>_class()" result by name.
+func indexObjectClasses(typ string, js map[string]interface{}) map[string]map[string]interface{} {
+	classes := map[string]map[string]interface{}{}
+	baseKey := fmt.Sprintf("get_%s_class.%s_classes", typ, typ)
+	baseArray, isArray := GetNestedValueOrDefault(js, ToKeyPath(baseKey), []interface{}{}).([]interface{})
+	if isArray {
+		for _, c := range baseArray {
+			cName, isStr := GetNestedValueOrDefault(c, ToKeyPath("name"), "").(string)
+			cMap, isMap := c.(map[string]interface{})
+			if isStr && isMap {
+				classes[cName] = cMap
+			}
+		}
+	}
+	return classes
+}
+
+func (c *objectCache) load(typ string, entry *objectCacheEntry) {
+	defer close(entry.done)
+	var wg sync.WaitGroup
+	var listErr, classErr error
+	var listJs, classJs map[string]interface{}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		listJs, listErr = runOpCommandToJson(fmt.Sprintf("list %ss", typ))
+	}()
+	if objectTypeHasClass(typ) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			classJs, classErr = runOpCommandToJson(fmt.Sprintf("get_%s_class()", typ))
+		}()
+	}
+	wg.Wait()
+
+	if listErr != nil {
+		entry.err = listErr
+	} else if classErr != nil {
+		entry.err = classErr
+	}
+	if entry.err != nil {
+		appendActionLog(fmt.Sprintf("Object cache (failed to load) %s: %s\n", typ, entry.err.Error()))
+		return
+	}
+	entry.records = indexObjectRecords(listJs)
+	entry.classes = indexObjectClasses(typ, classJs)
+	appendActionLog(fmt.Sprintf("Object cache (loaded) %s: %d objects\n", typ, len(entry.records)))
+}
+
+// Returns the entry for a type, once loaded (by the first caller, which concurrent callers wait for).
+func (c *objectCache) loaded(typ string) *objectCacheEntry {
+	c.Lock()
+	entry, loading := c.types[typ]
+	if !loading {
+		entry = &objectCacheEntry{done: make(chan struct{})}
+		c.types[typ] = entry
+		go c.load(typ, entry)
+	}
+	c.Unlock()
+	<-entry.done
+	return entry
+}
+
+// Returns (copies of) the cached object and its class, loading the type on first use.
+// Not found if the object was written during this run, or the type failed to load.
+func (c *objectCache) Get(typ string, name string) (map[string]interface{}, map[string]interface{}, bool) {
+	c.Lock()
+	stale := c.stale[typ+":"+name]
+	c.Unlock()
+	if stale {
+		return nil, nil, false
+	}
+	entry := c.loaded(typ)
+	if entry.err != nil {
+		return nil, nil, false
+	}
+	record, found := entry.records[name]
+	if !found {
+		return nil, nil, false
+	}
+	class := map[string]interface{}{}
+	if objectTypeHasClass(typ) {
+		cls, hasClass := entry.classes[name]
+		if !hasClass {
+			return nil, nil, false
+		}
+		class = DeepCopy(cls).(map[string]interface{})
+	}
+	return DeepCopy(record).(map[string]interface{}), class, true
+}
+
+// Returns the names of all cached objects of a type, loading it on first use.
+func (c *objectCache) Names(typ string) ([]string, bool) {
+	entry := c.loaded(typ)
+	if entry.err != nil {
+		return nil, false
+	}
+	names := []string{}
+	for name, _ := range entry.records {
+		names = append(names, name)
+	}
+	// include objects written since the type was loaded (e.g. created by this run)
+	c.Lock()
+	for key, _ := range c.stale {
+		if strings.HasPrefix(key, typ+":") {
+			name := key[len(typ)+1:]
+			if _, cached := entry.records[name]; !cached {
+				names = append(names, name)
+			}
+		}
+	}
+	c.Unlock()
+	sort.Strings(names)
+	return names, true
+}
+
+// Marks an object as written, so it is re-read from the backend.
+func (c *objectCache) Invalidate(typ string, name string) {
+	c.Lock()
+	defer c.Unlock()
+	c.stale[typ+":"+name] = true
+}
+
+// Invalidates a written object in the provider's cache (if any).
+func invalidateCachedObject(meta interface{}, typ string, name string) {
+	client, isClient := meta.(*apiClient)
+	if isClient && client != nil && client.cache != nil {
+		client.cache.Invalidate(typ, name)
+	}
+}
+
+// Returns the backend version, querying the backend only on first use by this provider instance.
+func (client *apiClient) BackendVersion() VersionRecord {
+	if client == nil {
+		return GetBackendVersionInfoStruct()
+	}
+	client.versionLock.Lock()
+	defer client.versionLock.Unlock()
+	if client.backendVersion == nil {
+		ver := GetBackendVersionInfoStruct()
+		if !ver.Valid {
+			// don't memoize failures (e.g. transient network errors)
+			return ver
+		}
+		client.backendVersion = &ver
+		appendActionLog(fmt.Sprintf("Detected backend version: '%s' (%d.%d.%d)\n", ver.Version, ver.Major, ver.Minor, ver.Patch))
+	}
+	return *client.backendVersion
+}
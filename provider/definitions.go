@@ -0,0 +1,362 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// Object definitions (ObjectConfigJsonStr) can optionally be loaded from the backend,
+// so that new backend fields don't require a provider release. This is opt-in via
+// SHORELINE_REMOTE_DEFINITIONS.
+// Schemas are built before the provider block is configured (and without network access),
+// so they come from a local cache of the backend's definitions. The cache is refreshed
+// once per process when the provider is configured, with its credentials, and changes
+// are used from the next run. The embedded copy is the fallback.
+
+// The op statement that returns the backend's object definitions. Backends without it (see
+// opMinVersions) only produce a warning, and the cached or embedded definitions are used.
+const remoteObjectConfigOp = "terraform_object_config"
+
+// Attribute metadata keys understood by resourceShorelineObject(), and the JSON kind of their value.
+var objectAttrVocabulary = map[string]string{
+	"type":                "string",
+	"value":               "any",
+	"default":             "any",
+	"optional":            "bool",
+	"required":            "bool",
+	"computed":            "bool",
+	"forcenew":            "bool",
+	"skip":                "bool",
+	"primary":             "bool",
+	"internal":            "bool",
+	"not_stored":          "bool",
+	"deprecated":          "bool",
+	"step":                "string",
+	"outtype":             "string",
+	"min_ver":             "string",
+	"match_null":          "any",
+	"suppress_null_regex": "string",
+	"compound_in":         "string",
+	"compound_out":        "string",
+	"alias":               "string",
+	"alias_out":           "string_or_list",
+	"versions":            "map",
+	"deprecated_for":      "string",
+	"replaces":            "string",
+	"proxy":               "string",
+	"refs":                "map",
+	"check_refs":          "bool",
+	"param":               "string",
+	"omit":                "map",
+	"omit_items":          "map",
+	"cast":                "map",
+	"force_set":           "list",
+	"skip_diff":           "list",
+	"sensitive":           "bool",
+	"write_only":          "bool",
+	"rotate_with":         "string",
+	"enum":                "list",
+	"regex":               "string",
+	"min":                 "number",
+	"max":                 "number",
+	"length":              "list",
+	"advisory":            "bool",
+	"exactly_one_of":      "list",
+}
+
+// Attribute types understood by resourceShorelineObject().
+var objectAttrTypes = map[string]bool{
+	"command":    true,
+	"time_s":     true,
+	"b64json":    true,
+	"string":     true,
+	"string[]":   true,
+	"string_set": true,
+	"bool":       true,
+	"intbool":    true,
+	"float":      true,
+	"int":        true,
+	"unsigned":   true,
+	"label":      true,
+	"resource":   true,
+}
+
+func validateAttrMetaKind(kind string, val interface{}) bool {
+	switch kind {
+	case "bool":
+		_, ok := val.(bool)
+		return ok
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "map":
+		_, ok := val.(map[string]interface{})
+		return ok
+	case "list":
+		_, ok := val.([]interface{})
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "string_or_list":
+		switch val.(type) {
+		case string:
+			return true
+		case []interface{}:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// Checks that an object definition config only uses known metadata, with values of the right kind.
+// Every object type in 'required' must be defined, and define a "name".
+func ValidateObjectConfig(configJsStr string, required []string) error {
+	objects := map[string]interface{}{}
+	err := json.Unmarshal([]byte(configJsStr), &objects)
+	if err != nil {
+		return fmt.Errorf("Failed to parse object definitions: %s", err.Error())
+	}
+	for _, typ := range required {
+		_, exists := objects[typ]
+		if !exists {
+			return fmt.Errorf("Object definitions are missing type '%s'", typ)
+		}
+	}
+	for typ, object := range objects {
+		if typ == "docs" {
+			continue
+		}
+		attributes, isMap := GetNestedValueOrDefault(object, ToKeyPath("attributes"), nil).(map[string]interface{})
+		if !isMap {
+			return fmt.Errorf("Object definition '%s' has no attributes", typ)
+		}
+		if _, hasName := attributes["name"]; !hasName {
+			return fmt.Errorf("Object definition '%s' has no 'name' attribute", typ)
+		}
+		ready := GetNestedValueOrDefault(object, ToKeyPath("ready"), nil)
+		if ready != nil {
+			if err := validateReadyCheck(typ, ready, attributes); err != nil {
+				return err
+			}
+		}
+		if err := validateObjectServices(typ, object, attributes); err != nil {
+			return err
+		}
+		rename := GetNestedValueOrDefault(object, ToKeyPath("rename"), nil)
+		if rename != nil {
+			if err := validateRenameOp(typ, rename); err != nil {
+				return err
+			}
+		}
+		for key, attr := range attributes {
+			if strings.HasPrefix(key, "#") {
+				// commented out
+				continue
+			}
+			attrMap, isMap := attr.(map[string]interface{})
+			if !isMap {
+				return fmt.Errorf("Attribute '%s.%s' is not an object", typ, key)
+			}
+			for meta, val := range attrMap {
+				kind, known := objectAttrVocabulary[meta]
+				if !known {
+					return fmt.Errorf("Attribute '%s.%s' has unknown metadata '%s'", typ, key, meta)
+				}
+				if !validateAttrMetaKind(kind, val) {
+					return fmt.Errorf("Attribute '%s.%s' metadata '%s' should be a %s, got: %v", typ, key, meta, kind, val)
+				}
+			}
+			attrTyp := GetNestedValueOrDefault(attrMap, ToKeyPath("type"), "string").(string)
+			if !objectAttrTypes[attrTyp] {
+				return fmt.Errorf("Attribute '%s.%s' has unknown type '%s'", typ, key, attrTyp)
+			}
+			rotateWith, isStr := attrMap["rotate_with"].(string)
+			if _, exists := attributes[rotateWith]; isStr && !exists {
+				return fmt.Errorf("Attribute '%s.%s' rotates with unknown attribute '%s'", typ, key, rotateWith)
+			}
+			oneOf, _ := attrMap["exactly_one_of"].([]interface{})
+			for _, other := range oneOf {
+				if _, exists := attributes[CastToString(other)]; !exists {
+					return fmt.Errorf("Attribute '%s.%s' is exclusive with unknown attribute '%v'", typ, key, other)
+				}
+			}
+			if checkRefs, _ := attrMap["check_refs"].(bool); checkRefs {
+				if _, hasRefs := attrMap["refs"]; !hasRefs || (attrTyp != "string[]" && attrTyp != "string_set") {
+					return fmt.Errorf("Attribute '%s.%s' check_refs needs a list type with refs", typ, key)
+				}
+			}
+			refs, _ := attrMap["refs"].(map[string]interface{})
+			for refTyp, policy := range refs {
+				if _, isStr := policy.(string); isStr {
+					if _, known := refPolicyOrder[refPolicy(policy)]; !known {
+						return fmt.Errorf("Attribute '%s.%s' has unknown refs policy '%v' for '%s'", typ, key, policy, refTyp)
+					}
+				}
+			}
+			minVer, isStr := attrMap["min_ver"].(string)
+			if isStr && !ParseVersionString(minVer).Valid {
+				return fmt.Errorf("Attribute '%s.%s' has invalid min_ver '%s'", typ, key, minVer)
+			}
+			if err := validateAttrMetaRules(attrMap); err != nil {
+				return fmt.Errorf("Attribute '%s.%s' %s", typ, key, err.Error())
+			}
+			regexes := []string{"compound_in", "suppress_null_regex"}
+			for _, r := range regexes {
+				reStr, isStr := attrMap[r].(string)
+				if isStr {
+					_, err := regexp.Compile(reStr)
+					if err != nil {
+						return fmt.Errorf("Attribute '%s.%s' has invalid %s: %s", typ, key, r, err.Error())
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// The object types that the provider registers resources for.
+func embeddedObjectTypes() []string {
+	objects := map[string]interface{}{}
+	json.Unmarshal([]byte(ObjectConfigJsonStr), &objects)
+	types := []string{}
+	for typ, _ := range objects {
+		if typ != "docs" {
+			types = append(types, typ)
+		}
+	}
+	return types
+}
+
+func getObjectConfigCacheFilename() string {
+	cacheFile, hasCache := os.LookupEnv("SHORELINE_DEFINITIONS_CACHE")
+	if hasCache && cacheFile != "" {
+		return cacheFile
+	}
+	return filepath.Join(GetDotfilePath(), ".tf_object_config.json")
+}
+
+// Backfills the user docs from the embedded definitions, if the backend doesn't supply them.
+func mergeEmbeddedDocs(configJsStr string) string {
+	objects := map[string]interface{}{}
+	embedded := map[string]interface{}{}
+	if json.Unmarshal([]byte(configJsStr), &objects) != nil || json.Unmarshal([]byte(ObjectConfigJsonStr), &embedded) != nil {
+		return configJsStr
+	}
+	docs, hasDocs := objects["docs"].(map[string]interface{})
+	if !hasDocs {
+		docs = map[string]interface{}{}
+		objects["docs"] = docs
+	}
+	embeddedDocs, _ := embedded["docs"].(map[string]interface{})
+	MergeObjects(docs, embeddedDocs, false)
+	b, err := json.Marshal(objects)
+	if err != nil {
+		return configJsStr
+	}
+	return string(b)
+}
+
+func remoteObjectConfigEnabled() bool {
+	enabled, _ := CastToBoolMaybe(os.Getenv("SHORELINE_REMOTE_DEFINITIONS"))
+	return enabled
+}
+
+// Fetches the backend's object definitions (with the configured provider's credentials).
+func fetchRemoteObjectConfig() (string, error) {
+	js, err := runOpCommandToJson(remoteObjectConfigOp)
+	if err != nil {
+		return "", err
+	}
+	confStr, isStr := GetNestedValueOrDefault(js, ToKeyPath("get_"+remoteObjectConfigOp), nil).(string)
+	if !isStr || confStr == "" {
+		return "", fmt.Errorf("Backend returned no object definitions")
+	}
+	return confStr, nil
+}
+
+// Returns the object definitions to build resources from: the cached copy of the backend's
+// definitions, if enabled and valid, or else the embedded copy. This doesn't access the backend.
+func LoadObjectConfig() string {
+	if !remoteObjectConfigEnabled() {
+		return ObjectConfigJsonStr
+	}
+	cacheFile := getObjectConfigCacheFilename()
+	cached, ok := ReadStringFromFile(cacheFile, "object definitions cache", false)
+	if ok {
+		err := ValidateObjectConfig(cached, embeddedObjectTypes())
+		if err == nil {
+			appendActionLog(fmt.Sprintf("Using cached object definitions from %s\n", cacheFile))
+			return cached
+		}
+		appendActionLog(fmt.Sprintf("Invalid cached object definitions in %s: %s\n", cacheFile, err.Error()))
+	}
+	appendActionLog("Using embedded object definitions\n")
+	return ObjectConfigJsonStr
+}
+
+var objectConfigRefresh struct {
+	once  sync.Once
+	diags diag.Diagnostics
+}
+
+// Refreshes the cached object definitions from the backend, if enabled, once per process.
+func RefreshObjectConfig(inUse string, meta interface{}) diag.Diagnostics {
+	if !remoteObjectConfigEnabled() {
+		return nil
+	}
+	objectConfigRefresh.once.Do(func() {
+		objectConfigRefresh.diags = refreshObjectConfigCache(inUse, meta)
+	})
+	return objectConfigRefresh.diags
+}
+
+// Caches the backend's object definitions, if valid. Warns if they couldn't be loaded,
+// or if they differ from the definitions in use ('inUse'), which only change on the next run.
+func refreshObjectConfigCache(inUse string, meta interface{}) diag.Diagnostics {
+	cacheFile := getObjectConfigCacheFilename()
+	remote := ""
+	err := checkOpSupported(meta, remoteObjectConfigOp, "Loading object definitions from the backend")
+	if err == nil {
+		remote, err = fetchRemoteObjectConfig()
+	}
+	if err == nil {
+		remote = mergeEmbeddedDocs(remote)
+		err = ValidateObjectConfig(remote, embeddedObjectTypes())
+	}
+	if err != nil {
+		appendActionLog(fmt.Sprintf("Failed to load object definitions from backend: %s\n", err.Error()))
+		return diag.Diagnostics{diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Failed to load object definitions from the backend, using the cached or embedded ones.",
+			Detail:   err.Error(),
+		}}
+	}
+	if remote == inUse {
+		return nil
+	}
+	appendActionLog(fmt.Sprintf("Caching object definitions from backend to %s\n", cacheFile))
+	if !WriteStringToFile(cacheFile, remote, "object definitions cache", false, true) {
+		return diag.Diagnostics{diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Failed to cache the backend's object definitions to %s.", cacheFile),
+		}}
+	}
+	return diag.Diagnostics{diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  "The backend's object definitions changed, and are used from the next run.",
+		Detail:   fmt.Sprintf("They were cached to %s.", cacheFile),
+	}}
+}
@@ -0,0 +1,275 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Dependency-aware deletion.
+//
+// The "refs" attribute metadata in ObjectConfigJsonStr names the object types an attribute
+// can reference, and what a forced delete ("force_destroy") does with the referencing object:
+//   "refs": { "action": 1 }         -- disable the referencing object (the default)
+//   "refs": { "file": "detach" }    -- remove the name from the (list) attribute
+//   "refs": { "action": "keep" }    -- leave the referencing object as is (e.g. an action sequence,
+//                                      which would run differently without the step)
+// Referencing objects are never deleted. Those that can't be disabled or detached are reported,
+// to be changed or removed in the configuration.
+// Deletes of referenced objects are retried (within the delete timeout), in case the referencing
+// objects are being destroyed in the same run.
+
+const deleteTimeoutDefault = 1 * time.Minute
+
+// Order in which forced deletes handle referencing objects.
+var refPolicyOrder = map[string]int{"disable": 0, "detach": 1, "keep": 2}
+
+// An attribute of another object type that can reference an object.
+type objectReferrer struct {
+	typ    string
+	key    string
+	policy string
+	attrs  map[string]interface{}
+}
+
+// An object that references the one being deleted.
+type objectReference struct {
+	objectReferrer
+	name string
+	val  interface{}
+}
+
+func refPolicy(val interface{}) string {
+	policy, isStr := val.(string)
+	if isStr && policy != "" {
+		return policy
+	}
+	return "disable"
+}
+
+// The attributes (of any object type) that can reference objects of type 'typ'.
+func objectReferrerTypes(objects map[string]interface{}, typ string) []objectReferrer {
+	referrers := []objectReferrer{}
+	for rtyp, object := range objects {
+		if rtyp == "docs" {
+			continue
+		}
+		attrs, isMap := GetNestedValueOrDefault(object, ToKeyPath("attributes"), nil).(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		for key, attr := range attrs {
+			refs, hasRefs := GetNestedValueOrDefault(attr, ToKeyPath("refs"), nil).(map[string]interface{})
+			if !hasRefs || strings.HasPrefix(key, "#") {
+				continue
+			}
+			if policy, isRef := refs[typ]; isRef {
+				referrers = append(referrers, objectReferrer{typ: rtyp, key: key, policy: refPolicy(policy), attrs: attrs})
+			}
+		}
+	}
+	sort.Slice(referrers, func(i, j int) bool {
+		return referrers[i].typ+"."+referrers[i].key < referrers[j].typ+"."+referrers[j].key
+	})
+	return referrers
+}
+
+// The object named by a list item: either just the name, or a call with parameters (e.g. "my_action(x=1)").
+func listItemObjectName(item interface{}) string {
+	re := regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*`)
+	return re.FindString(CastToString(item))
+}
+
+// Whether an attribute value (an op statement, or a list of names) references the named object.
+func ReferencesObject(val interface{}, name string) bool {
+	switch val.(type) {
+	case string:
+		re := regexp.MustCompile(`(^|[^a-zA-Z0-9_])` + regexp.QuoteMeta(name) + `([^a-zA-Z0-9_]|$)`)
+		return re.MatchString(val.(string))
+	case []interface{}:
+		for _, v := range val.([]interface{}) {
+			if listItemObjectName(v) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The names of all objects of a type (from the provider's cache when possible).
+func listShorelineObjectNames(meta interface{}, typ string) ([]string, error) {
+	client, isClient := meta.(*apiClient)
+	if isClient && client != nil && client.cache != nil {
+		names, ok := client.cache.Names(typ)
+		if ok {
+			return names, nil
+		}
+	}
+	js, err := runOpCommandToJson(fmt.Sprintf("list %ss", typ))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name, _ := range indexObjectRecords(js) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Finds the objects that still reference the named object.
+func findShorelineObjectReferences(meta interface{}, typ string, name string, referrers []objectReferrer) ([]objectReference, error) {
+	found := []objectReference{}
+	names := map[string][]string{}
+	for _, r := range referrers {
+		if _, listed := names[r.typ]; !listed {
+			rnames, err := listShorelineObjectNames(meta, r.typ)
+			if err != nil {
+				return nil, err
+			}
+			names[r.typ] = rnames
+		}
+		for _, rname := range names[r.typ] {
+			if r.typ == typ && rname == name {
+				continue
+			}
+			record, stepsJs, diags := readShorelineObjectRecord(meta, r.typ, rname)
+			if diags != nil {
+				// e.g. deleted since it was listed
+				continue
+			}
+			skip, val, _ := resourceShorelineObjectReadSingleAttr(rname, r.typ, r.key, r.attrs, record, stepsJs, nil)
+			if skip || val == nil {
+				continue
+			}
+			if ReferencesObject(val, name) {
+				found = append(found, objectReference{objectReferrer: r, name: rname, val: val})
+			}
+		}
+	}
+	return found, nil
+}
+
+func describeObjectReferences(refs []objectReference) string {
+	descs := []string{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		desc := fmt.Sprintf("%s '%s'", ref.typ, ref.name)
+		if !seen[desc] {
+			seen[desc] = true
+			descs = append(descs, desc)
+		}
+	}
+	return strings.Join(descs, ", ")
+}
+
+// Disables, then detaches the referencing objects, so the named object can be deleted.
+// Returns the ones that can't be handled (kept, or that can't be disabled).
+func detachShorelineObjectReferences(meta interface{}, name string, refs []objectReference) ([]objectReference, diag.Diagnostics) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refPolicyOrder[refs[i].policy] < refPolicyOrder[refs[j].policy]
+	})
+	unhandled := []objectReference{}
+	for _, ref := range refs {
+		appendActionLog(fmt.Sprintf("Force delete of '%s': %s %s '%s' (%s)\n", name, ref.policy, ref.typ, ref.name, ref.key))
+		invalidateCachedObject(meta, ref.typ, ref.name)
+		switch ref.policy {
+		case "detach":
+			remaining := []interface{}{}
+			for _, v := range CastToArray(ref.val) {
+				if listItemObjectName(v) != name {
+					remaining = append(remaining, v)
+				}
+			}
+			diags := setFieldViaOp(ref.typ, ref.attrs, ref.name, ref.key, remaining)
+			if diags != nil {
+				return unhandled, diags
+			}
+		case "keep":
+			unhandled = append(unhandled, ref)
+		default:
+			if _, canEnable := ref.attrs["enabled"]; !canEnable {
+				unhandled = append(unhandled, ref)
+				continue
+			}
+			diags := setObjectEnabled(ref.typ, ref.name, false)
+			if diags != nil {
+				return unhandled, diags
+			}
+		}
+	}
+	return unhandled, nil
+}
+
+func deleteShorelineObject(typ string, name string) error {
+	result, err := runOpCommand(fmt.Sprintf("delete %s", name), true)
+	if err != nil {
+		return err
+	}
+	return CheckUpdateResult(result)
+}
+
+// Deletes an object, handling (or reporting) objects that still reference it,
+// and retrying until the timeout while they do.
+func deleteShorelineObjectWithRefs(ctx context.Context, meta interface{}, typ string, name string, referrers []objectReferrer, force bool, timeout time.Duration) diag.Diagnostics {
+	deadline := time.Now().Add(timeout)
+	wait := pollIntervalMin
+	unhandled := []objectReference{}
+	for {
+		if force && len(referrers) > 0 {
+			refs, err := findShorelineObjectReferences(meta, typ, name, referrers)
+			if err != nil {
+				return diag.Errorf("Failed to find objects referencing %s '%s': %s", typ, name, err.Error())
+			}
+			var diags diag.Diagnostics
+			unhandled, diags = detachShorelineObjectReferences(meta, name, refs)
+			if diags != nil {
+				return diags
+			}
+		}
+
+		err := deleteShorelineObject(typ, name)
+		if err == nil {
+			return nil
+		}
+		if len(referrers) == 0 {
+			return diag.Errorf("Failed to delete %s: %s", typ, err.Error())
+		}
+		refs, findErr := findShorelineObjectReferences(meta, typ, name, referrers)
+		if findErr != nil || len(refs) == 0 {
+			return diag.Errorf("Failed to delete %s: %s", typ, err.Error())
+		}
+		pending := describeObjectReferences(refs)
+		appendActionLog(fmt.Sprintf("Delete of %s '%s' pending, still referenced by: %s\n", typ, name, pending))
+
+		if time.Now().Add(wait).After(deadline) {
+			msg := fmt.Sprintf("Failed to delete %s '%s', it is still referenced by: %s", typ, name, pending)
+			if !force {
+				msg += " (set force_destroy to disable or detach them first)"
+			} else if len(unhandled) > 0 {
+				msg += fmt.Sprintf(" (force_destroy can't disable or detach %s, so change or remove them first)", describeObjectReferences(unhandled))
+			}
+			return diag.Errorf("%s: %s", msg, err.Error())
+		}
+		var cancelled bool
+		wait, cancelled = pollBackoff(ctx, wait)
+		if cancelled {
+			return diag.Errorf("Cancelled deleting %s '%s', still referenced by: %s", typ, name, pending)
+		}
+	}
+}
+
+// Imports objects with the local-only "force_destroy" set to its default.
+func resourceShorelineObjectImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	d.Set("force_destroy", false)
+	return []*schema.ResourceData{d}, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// shoreline_enablement owns the enabled state of an object defined elsewhere,
+// so that e.g. on-call can disable a bot without touching its definition.
+// The definition leaves 'enabled' unset, which keeps whatever state the backend has.
+
+// The object types (from the definitions) that can be enabled/disabled.
+func enablementObjectTypes(configJsStr string) []string {
+	objects := map[string]interface{}{}
+	json.Unmarshal([]byte(configJsStr), &objects)
+	types := []string{}
+	for typ, object := range objects {
+		if typ == "docs" {
+			continue
+		}
+		if GetNestedValueOrDefault(object, ToKeyPath("attributes.enabled"), nil) != nil {
+			types = append(types, typ)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func resourceShorelineEnablement(configJsStr string) *schema.Resource {
+	types := enablementObjectTypes(configJsStr)
+	return &schema.Resource{
+		Description: "Shoreline enablement. Owns the enabled state of an object that is defined elsewhere.\n\n" +
+			"The resource that defines the object should leave its `enabled` field unset, so that it keeps the state set here " +
+			"(including after other changes to the object, which OpLang disables it for).",
+
+		CreateContext: resourceShorelineEnablementCreate,
+		ReadContext:   resourceShorelineEnablementRead,
+		UpdateContext: resourceShorelineEnablementUpdate,
+		DeleteContext: resourceShorelineEnablementDelete,
+		Importer:      &schema.ResourceImporter{StateContext: resourceShorelineEnablementImport},
+
+		Schema: map[string]*schema.Schema{
+			"object_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					if !ValidateVariableName(val.(string)) {
+						errs = append(errs, fmt.Errorf("%q must be a valid object name (^[_a-zA-Z][_a-zA-Z0-9]*$),\n but got: %s", key, val.(string)))
+					}
+					return
+				},
+				Description: "The name of the object to enable or disable.",
+			},
+			"object_type": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					for _, t := range types {
+						if val.(string) == t {
+							return
+						}
+					}
+					errs = append(errs, fmt.Errorf("%q must be one of (%s),\n but got: %s", key, strings.Join(types, ", "), val.(string)))
+					return
+				},
+				Description: "The type of the object, one of: " + strings.Join(types, ", ") + ".",
+			},
+			"enabled": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "If the object is enabled.",
+			},
+		},
+	}
+}
+
+func resourceShorelineEnablementApply(d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	typ := d.Get("object_type").(string)
+	name := d.Get("object_name").(string)
+	desired := d.Get("enabled").(bool)
+	appendActionLog(fmt.Sprintf("Setting enablement of %s: '%s' to %v\n", typ, name, desired))
+	invalidateCachedObject(meta, typ, name)
+	return setObjectEnabled(typ, name, desired)
+}
+
+func resourceShorelineEnablementCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	diags := resourceShorelineEnablementApply(d, meta)
+	if diags != nil {
+		return diags
+	}
+	d.SetId(d.Get("object_type").(string) + ":" + d.Get("object_name").(string))
+	return resourceShorelineEnablementRead(ctx, d, meta)
+}
+
+func resourceShorelineEnablementRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	typ := d.Get("object_type").(string)
+	name := d.Get("object_name").(string)
+	appendActionLog(fmt.Sprintf("Reading enablement of %s: '%s'\n", typ, name))
+
+	record, _, diags := readShorelineObjectRecord(meta, typ, name)
+	if diags != nil {
+		return diags
+	}
+	// changes made elsewhere (e.g. in the UI) show up as a diff
+	enabled := CastToBool(GetNestedValueOrDefault(record, ToKeyPath("attributes.enabled"), false))
+	d.Set("enabled", enabled)
+	return nil
+}
+
+func resourceShorelineEnablementUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	diags := resourceShorelineEnablementApply(d, meta)
+	if diags != nil {
+		return diags
+	}
+	return resourceShorelineEnablementRead(ctx, d, meta)
+}
+
+// The object is left in its current state once the resource is gone.
+func resourceShorelineEnablementDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	typ := d.Get("object_type").(string)
+	name := d.Get("object_name").(string)
+	appendActionLog(fmt.Sprintf("Deleting enablement of %s: '%s' (left as is)\n", typ, name))
+	return nil
+}
+
+// Imports from an id of the form "<object_type>:<object_name>".
+func resourceShorelineEnablementImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Enablement id should be of the form '<object_type>:<object_name>', but got: %s", d.Id())
+	}
+	d.Set("object_type", parts[0])
+	d.Set("object_name", parts[1])
+	return []*schema.ResourceData{d}, nil
+}
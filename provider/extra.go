@@ -0,0 +1,185 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Pass-through of backend attributes that ObjectConfigJsonStr doesn't model (yet), e.g.:
+//   extra_attributes = { communication_workspace = "ops", some_limit = "3" }
+// Values are strings in terraform. They are sent as "<name>.<key> = <value>" with an inferred
+// type (bool, number, list of strings, or string), and read back from the object's attributes.
+// A value in double quotes is always a string, e.g. zip = "\"01234\"" (rather than the number 1234).
+// Only the keys in the configuration are managed: removing a key leaves the backend value as is.
+
+// Infers the attribute type of a pass-through value, and converts it to that type.
+func inferExtraAttrType(val string) (string, interface{}) {
+	if len(val) >= 2 && strings.HasPrefix(val, `"`) && strings.HasSuffix(val, `"`) {
+		unquoted := ""
+		if json.Unmarshal([]byte(val), &unquoted) == nil {
+			return "string", unquoted
+		}
+	}
+	if val == "true" || val == "false" {
+		return "bool", val == "true"
+	}
+	if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return "int", i
+	}
+	if f, err := strconv.ParseFloat(val, 64); err == nil {
+		return "float", f
+	}
+	if strings.HasPrefix(val, "[") {
+		list := []interface{}{}
+		if json.Unmarshal([]byte(val), &list) == nil {
+			return "string[]", list
+		}
+	}
+	return "string", val
+}
+
+// The op statement literal for a pass-through value.
+func extraAttrValueString(typ string, key string, val string) string {
+	attrTyp, typed := inferExtraAttrType(val)
+	attrs := map[string]interface{}{key: map[string]interface{}{"type": attrTyp}}
+	return attrValueString(typ, key, typed, attrs)
+}
+
+// The (canonical) terraform string for a backend or configured value, so e.g. "1.0" and 1 don't diff.
+func NormalizeExtraAttrValue(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(val.(bool))
+	case float64:
+		return strconv.FormatFloat(val.(float64), 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(val.(int64), 10)
+	case string:
+		attrTyp, typed := inferExtraAttrType(val.(string))
+		if attrTyp == "string" {
+			// only strings that would otherwise be inferred as another type stay quoted
+			if unquotedTyp, _ := inferExtraAttrType(typed.(string)); unquotedTyp != "string" {
+				js, _ := json.Marshal(typed)
+				return string(js)
+			}
+			return typed.(string)
+		}
+		if attrTyp == "int" {
+			return NormalizeExtraAttrValue(float64(typed.(int64)))
+		}
+		return NormalizeExtraAttrValue(typed)
+	}
+	js, err := json.Marshal(val)
+	if err != nil {
+		return CastToString(val)
+	}
+	return string(js)
+}
+
+// The terraform string for a value read from the backend, where strings are always strings.
+func normalizeBackendExtraAttrValue(val interface{}) string {
+	if str, isStr := val.(string); isStr {
+		js, _ := json.Marshal(str)
+		return NormalizeExtraAttrValue(string(js))
+	}
+	return NormalizeExtraAttrValue(val)
+}
+
+func extraAttributesSchema(attrs map[string]interface{}) *schema.Schema {
+	modeled := map[string]bool{}
+	for key, _ := range attrs {
+		modeled[key] = true
+		for _, out := range attrOutNames(attrs, key) {
+			modeled[out] = true
+		}
+	}
+	return &schema.Schema{
+		Type:     schema.TypeMap,
+		Optional: true,
+		Elem:     &schema.Schema{Type: schema.TypeString},
+		ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+			extras, _ := val.(map[string]interface{})
+			for k, _ := range extras {
+				if !ValidateVariableName(k) {
+					errs = append(errs, fmt.Errorf("%q keys must be valid attribute names (^[_a-zA-Z][_a-zA-Z0-9]*$), got: '%s'", key, k))
+				} else if modeled[k] {
+					errs = append(errs, fmt.Errorf("%q key '%s' is already an attribute of the object, set it directly instead", key, k))
+				}
+			}
+			return
+		},
+		DiffSuppressFunc: func(k, old, nu string, d *schema.ResourceData) bool {
+			if k == "extra_attributes.%" {
+				return false
+			}
+			return old != "" && nu != "" && NormalizeExtraAttrValue(old) == NormalizeExtraAttrValue(nu)
+		},
+		Description: "Object attributes that the provider doesn't support yet, sent to the backend as is (with bool, number, list or string type inferred from the value). " +
+			"A value in double quotes is always sent as a string, e.g. `zip = \"\\\"01234\\\"\"`. " +
+			"Only the listed keys are managed, and removing a key leaves its backend value unchanged.",
+	}
+}
+
+// Sets the (changed) pass-through attributes. Returns whether any were written.
+func setExtraAttributes(typ string, name string, d *schema.ResourceData, doDiff bool) (bool, diag.Diagnostics) {
+	if doDiff && !d.HasChange("extra_attributes") {
+		return false, nil
+	}
+	oldVal, nuVal := d.GetChange("extra_attributes")
+	oldExtras, _ := oldVal.(map[string]interface{})
+	extras, _ := nuVal.(map[string]interface{})
+
+	keys := []string{}
+	for key, _ := range extras {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var failed diag.Diagnostics
+	changed := false
+	for _, key := range keys {
+		val := CastToString(extras[key])
+		if doDiff && NormalizeExtraAttrValue(oldExtras[key]) == NormalizeExtraAttrValue(val) {
+			continue
+		}
+		op := fmt.Sprintf("%s.%s = %s", name, key, extraAttrValueString(typ, key, val))
+		appendActionLog(fmt.Sprintf("Setting %s extra attribute: '%s'.'%s' with op statement... '%s'\n", typ, name, key, op))
+		result, err := runOpCommand(op, true)
+		if err == nil {
+			err = CheckUpdateResult(result)
+		}
+		if err != nil {
+			failed = append(failed, diag.Errorf("Failed to set %s %s.%s (extra_attributes): %s", typ, name, key, err.Error())...)
+			continue
+		}
+		changed = true
+	}
+	return changed, failed
+}
+
+// Reads back the managed pass-through attributes from the object's record.
+// Keys missing on the backend are dropped, so they show up as a diff.
+func readExtraAttributes(typ string, name string, record map[string]interface{}, d *schema.ResourceData) map[string]interface{} {
+	extras, _ := d.Get("extra_attributes").(map[string]interface{})
+	out := map[string]interface{}{}
+	for key, _ := range extras {
+		val := GetNestedValueOrDefault(record, ToKeyPath("attributes."+key), nil)
+		if val == nil {
+			appendActionLog(fmt.Sprintf("Reading (missing) %s extra attribute: '%s'.'%s'\n", typ, name, key))
+			continue
+		}
+		out[key] = normalizeBackendExtraAttrValue(val)
+	}
+	return out
+}
@@ -0,0 +1,351 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"archive/tar"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	zstd "github.com/klauspost/compress/zstd"
+)
+
+// A file object's data comes from "input_file", from inline "content" (or "content_base64"),
+// or from "source_dir", which is packed as a tarball. The tarball is distributed as is, to
+// "destination_path"; it is extracted on the target resources by an explicit step, e.g. an
+// action with the file in its "file_deps".
+// The tarball's checksum is computed from the packed files' hashes (not the tarball bytes),
+// so it is stable across machines and provider builds. Like the checksum of inline content,
+// it is checked at plan time, so these don't need an "md5".
+
+// Inline file data (for backends without presigned uploads) is zstd compressed and base64
+// encoded in a single streaming pass, which also computes the md5 (see EncodeFileData()).
+const fileCompressionLevelDefault = 3
+const maxInlineFileSizeDefault = 64 * 1024 * 1024
+
+// The attributes that give a file object's data, other than "input_file".
+var fileSourceAttrs = []string{"source_dir", "include", "exclude", "content", "content_base64"}
+
+// A file selected from a source directory.
+type sourceDirFile struct {
+	Path string // relative, with "/" separators
+	Mode int64
+	Size int64
+	Md5  string
+}
+
+// Whether a relative path matches a glob: on the whole path, or on the base name
+// for globs without a "/" (so "*.jar" matches at any depth).
+func matchSourceGlob(glob string, rel string) bool {
+	if ok, _ := path.Match(glob, rel); ok {
+		return true
+	}
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(rel))
+		return ok
+	}
+	return false
+}
+
+func validateSourceGlobs(globs []string) error {
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob '%s': %s", glob, err.Error())
+		}
+	}
+	return nil
+}
+
+// Lists the regular files under 'dir' (sorted by path) that match any of 'include'
+// (all, if empty) and none of 'exclude'. Excluded directories are skipped entirely.
+func ListSourceDir(dir string, include []string, exclude []string) ([]sourceDirFile, error) {
+	if err := validateSourceGlobs(include); err != nil {
+		return nil, err
+	}
+	if err := validateSourceGlobs(exclude); err != nil {
+		return nil, err
+	}
+	excluded := func(rel string) bool {
+		for _, glob := range exclude {
+			if matchSourceGlob(glob, rel) {
+				return true
+			}
+		}
+		return false
+	}
+	included := func(rel string) bool {
+		if len(include) == 0 {
+			return true
+		}
+		for _, glob := range include {
+			if matchSourceGlob(glob, rel) {
+				return true
+			}
+		}
+		return false
+	}
+
+	files := []sourceDirFile{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if info.IsDir() {
+			if excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || excluded(rel) || !included(rel) {
+			return nil
+		}
+		sum, err := fileMd5(p)
+		if err != nil {
+			return err
+		}
+		// only the executable bit is kept, so the checksum doesn't depend on the umask
+		mode := int64(0644)
+		if info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		files = append(files, sourceDirFile{Path: rel, Mode: mode, Size: info.Size(), Md5: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// The checksum of a packed directory: the md5 of a "<md5> <mode> <path>" line per file.
+func SourceDirChecksum(files []sourceDirFile) string {
+	hash := md5.New()
+	for _, f := range files {
+		fmt.Fprintf(hash, "%s %o %s\n", f.Md5, f.Mode, f.Path)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// Writes the files (from ListSourceDir) as a tarball to 'out', with fixed owners and times.
+func WriteSourceDirTar(dir string, files []sourceDirFile, out io.Writer) error {
+	tw := tar.NewWriter(out)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.Path,
+			Mode:     f.Mode,
+			Size:     f.Size,
+			ModTime:  time.Unix(0, 0),
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		in, err := os.Open(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, in, f.Size)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("'%s' changed while packing: %s", f.Path, err.Error())
+		}
+	}
+	return tw.Close()
+}
+
+// Packs 'dir' into a temporary tarball, returning its path (to be removed by the caller),
+// its size and its checksum.
+func PackSourceDir(dir string, include []string, exclude []string) (string, int64, string, error) {
+	files, err := ListSourceDir(dir, include, exclude)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if len(files) == 0 {
+		return "", 0, "", fmt.Errorf("no files to pack in '%s'", dir)
+	}
+	out, err := ioutil.TempFile("", "shoreline_file_*.tar")
+	if err != nil {
+		return "", 0, "", err
+	}
+	err = WriteSourceDirTar(dir, files, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", 0, "", err
+	}
+	fstat, err := os.Stat(out.Name())
+	if err != nil {
+		os.Remove(out.Name())
+		return "", 0, "", err
+	}
+	return out.Name(), fstat.Size(), SourceDirChecksum(files), nil
+}
+
+// The globs of an "include" or "exclude" value.
+func sourceDirGlobs(val interface{}) []string {
+	globs := []string{}
+	if val == nil {
+		return globs
+	}
+	for _, g := range CastToArray(val) {
+		globs = append(globs, CastToString(g))
+	}
+	return globs
+}
+
+// Returns a file's data (zstd compressed at the given level, and base64 encoded), its size and its md5.
+// The file is read once, and only the encoded data is held in memory. With 'skipData' (for
+// presigned uploads), only the size and md5 are returned. Files over 'maxSize' (unless 0) fail.
+func EncodeFileData(filename string, skipData bool, level int, maxSize int64) (string, int64, string, error) {
+	fstat, err := os.Stat(filename)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if fstat.Size() == 0 {
+		return "", 0, "", fmt.Errorf("'%s' is empty", filename)
+	}
+	if !skipData && maxSize > 0 && fstat.Size() > maxSize {
+		return "", 0, "", fmt.Errorf("'%s' is %d bytes, over the %d byte limit for inline file data (the provider's max_inline_file_size). "+
+			"Larger files can only be uploaded to backends with presigned uploads.", filename, fstat.Size(), maxSize)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if skipData {
+		size, err := io.Copy(hash, file)
+		if err != nil {
+			return "", 0, "", err
+		}
+		return "", size, fmt.Sprintf("%x", hash.Sum(nil)), nil
+	}
+	encoded := &strings.Builder{}
+	b64 := base64.NewEncoder(base64.StdEncoding, encoded)
+	// zstd levels map onto the encoder's few speeds (see the provider's "file_compression_level")
+	zw, err := zstd.NewWriter(b64, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return "", 0, "", err
+	}
+	size, err := io.Copy(zw, io.TeeReader(file, hash))
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := b64.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, "", err
+	}
+	return encoded.String(), size, fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// The inline data of a file object ("content" or "content_base64"), and whether it has any.
+func fileContent(d schemaGetter) ([]byte, bool, error) {
+	if content, exists := d.GetOk("content"); exists {
+		return []byte(content.(string)), true, nil
+	}
+	if encoded, exists := d.GetOk("content_base64"); exists {
+		data, err := base64.StdEncoding.DecodeString(encoded.(string))
+		if err != nil {
+			return nil, true, fmt.Errorf("content_base64 is not valid base64: %s", err.Error())
+		}
+		return data, true, nil
+	}
+	return nil, false, nil
+}
+
+// Writes inline data to a temporary file (to be removed by the caller), to upload it as an input_file.
+func writeFileContent(data []byte) (string, error) {
+	out, err := ioutil.TempFile("", "shoreline_file_*")
+	if err != nil {
+		return "", err
+	}
+	_, err = out.Write(data)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// Plans an update of a file object when its inline content or the files of its source_dir change
+// (input_file objects rely on the "md5" proxy instead).
+func resourceShorelineFileDiff(d *schema.ResourceDiff) error {
+	for _, key := range fileSourceAttrs {
+		if !d.NewValueKnown(key) {
+			for _, computed := range []string{"checksum", "file_length", "file_data"} {
+				if err := d.SetNewComputed(computed); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	sum, length := "", -1
+	data, isContent, err := fileContent(d)
+	if err != nil {
+		return err
+	}
+	if isContent {
+		if len(data) == 0 {
+			return fmt.Errorf("File content is empty")
+		}
+		sum, length = fmt.Sprintf("%x", md5.Sum(data)), len(data)
+	} else if dir, hasDir := d.GetOk("source_dir"); hasDir {
+		files, err := ListSourceDir(dir.(string), sourceDirGlobs(d.Get("include")), sourceDirGlobs(d.Get("exclude")))
+		if err != nil {
+			return fmt.Errorf("Failed to read source_dir '%s': %s", dir, err.Error())
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("No files to pack in source_dir '%s'", dir)
+		}
+		sum = SourceDirChecksum(files)
+	} else {
+		return nil
+	}
+	if d.Get("checksum").(string) == sum && (length < 0 || d.Get("file_length").(int) == length) {
+		return nil
+	}
+	if err := d.SetNew("checksum", sum); err != nil {
+		return err
+	}
+	if length >= 0 {
+		err = d.SetNew("file_length", length)
+	} else {
+		// the tarball's length is only known once packed
+		err = d.SetNewComputed("file_length")
+	}
+	if err != nil {
+		return err
+	}
+	return d.SetNewComputed("file_data")
+}
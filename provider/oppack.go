@@ -0,0 +1,686 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// shoreline_op_pack installs a versioned bundle of objects (actions, alarms, bots, files, ...)
+// from a manifest, either inline or as "manifest.json" in a pack directory:
+//   {
+//     "name": "jvm_trace", "version": "1.2.0",
+//     "variables": { "namespace": { "default": "jvm_trace" }, "resource_query": {} },
+//     "objects": [
+//       { "type": "action", "name": "${var.namespace}_check_heap", "attributes": { "command": "...", ... } },
+//       { "type": "bot", "name": "${var.namespace}_dump_bot", "attributes": { ... }, "depends_on": ["..."] }
+//     ]
+//   }
+// "${var.<name>}" is substituted in object names and string attributes.
+// Objects are applied through the generic object resources (see resourceShorelineObject()),
+// in dependency order: an object depends on the pack objects that its "refs" attributes reference,
+// and on those listed in "depends_on". Only objects whose definition changed are updated,
+// objects dropped from the pack are deleted, and a failure rolls back to the installed version.
+
+const opPackManifestFile = "manifest.json"
+
+type opPackVariable struct {
+	Default     *string `json:"default"`
+	Description string  `json:"description"`
+}
+
+type opPackObject struct {
+	Type       string                 `json:"type"`
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes"`
+	DependsOn  []string               `json:"depends_on,omitempty"`
+	// sha256 of the rendered definition, see RenderOpPack()
+	Hash string `json:"hash,omitempty"`
+}
+
+type opPackManifest struct {
+	Name      string                    `json:"name"`
+	Version   string                    `json:"version"`
+	Variables map[string]opPackVariable `json:"variables"`
+	Objects   []opPackObject            `json:"objects"`
+}
+
+// The key of an object in "object_hashes".
+func (obj opPackObject) key() string {
+	return obj.Type + ":" + obj.Name
+}
+
+func ParseOpPackManifest(content string) (*opPackManifest, error) {
+	manifest := opPackManifest{}
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid op pack manifest: %s", err.Error())
+	}
+	if manifest.Name == "" || manifest.Version == "" {
+		return nil, fmt.Errorf("op pack manifest needs a name and version")
+	}
+	if len(manifest.Objects) == 0 {
+		return nil, fmt.Errorf("op pack '%s' has no objects", manifest.Name)
+	}
+	for v, _ := range manifest.Variables {
+		if !ValidateVariableName(v) {
+			return nil, fmt.Errorf("op pack '%s' has invalid variable name '%s'", manifest.Name, v)
+		}
+	}
+	return &manifest, nil
+}
+
+// Substitutes "${var.<name>}" in a string, recording any undefined variables.
+func expandOpPackVars(val string, vars map[string]string, missing map[string]bool) string {
+	re := regexp.MustCompile(`\$\{var\.([_a-zA-Z][_a-zA-Z0-9]*)\}`)
+	return re.ReplaceAllStringFunc(val, func(expr string) string {
+		name := re.FindStringSubmatch(expr)[1]
+		v, defined := vars[name]
+		if !defined {
+			missing[name] = true
+		}
+		return v
+	})
+}
+
+func expandOpPackValue(val interface{}, vars map[string]string, missing map[string]bool) interface{} {
+	switch val.(type) {
+	case string:
+		return expandOpPackVars(val.(string), vars, missing)
+	case []interface{}:
+		out := []interface{}{}
+		for _, v := range val.([]interface{}) {
+			out = append(out, expandOpPackValue(v, vars, missing))
+		}
+		return out
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, v := range val.(map[string]interface{}) {
+			out[k] = expandOpPackValue(v, vars, missing)
+		}
+		return out
+	}
+	return val
+}
+
+func fileMd5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Renders the manifest's objects with the given variable values, in install order.
+// Relative file paths ("input_file", "source_dir") are resolved against 'baseDir', and their content
+// is hashed (into "md5", or the object's hash for directories) so that content changes are upgraded.
+func RenderOpPack(manifest *opPackManifest, values map[string]interface{}, baseDir string, objects map[string]interface{}) ([]opPackObject, error) {
+	vars := map[string]string{}
+	for name, v := range manifest.Variables {
+		if v.Default != nil {
+			vars[name] = *v.Default
+		}
+	}
+	for name, val := range values {
+		if _, declared := manifest.Variables[name]; !declared {
+			return nil, fmt.Errorf("op pack '%s' has no variable '%s'", manifest.Name, name)
+		}
+		vars[name] = CastToString(val)
+	}
+
+	missing := map[string]bool{}
+	rendered := []opPackObject{}
+	seen := map[string]bool{}
+	for _, obj := range manifest.Objects {
+		attrDefs, isMap := GetNestedValueOrDefault(objects, ToKeyPath(obj.Type+".attributes"), nil).(map[string]interface{})
+		if obj.Type == "docs" || !isMap {
+			return nil, fmt.Errorf("op pack '%s' has object '%s' of unknown type '%s'", manifest.Name, obj.Name, obj.Type)
+		}
+		out := opPackObject{
+			Type:       obj.Type,
+			Name:       expandOpPackVars(obj.Name, vars, missing),
+			Attributes: map[string]interface{}{},
+		}
+		for _, dep := range obj.DependsOn {
+			out.DependsOn = append(out.DependsOn, expandOpPackVars(dep, vars, missing))
+		}
+		for key, val := range obj.Attributes {
+			if key == "name" {
+				return nil, fmt.Errorf("op pack '%s' %s '%s' sets 'name' in its attributes", manifest.Name, obj.Type, obj.Name)
+			}
+			out.Attributes[key] = expandOpPackValue(val, vars, missing)
+		}
+		if len(missing) > 0 {
+			continue
+		}
+		if !ValidateVariableName(out.Name) {
+			return nil, fmt.Errorf("op pack '%s' has invalid object name '%s'", manifest.Name, out.Name)
+		}
+		if seen[out.key()] {
+			return nil, fmt.Errorf("op pack '%s' has duplicate %s '%s'", manifest.Name, out.Type, out.Name)
+		}
+		seen[out.key()] = true
+
+		if path, isFile := out.Attributes["input_file"].(string); isFile && path != "" {
+			if !filepath.IsAbs(path) && baseDir != "" {
+				path = filepath.Join(baseDir, path)
+				out.Attributes["input_file"] = path
+			}
+			if _, hasMd5 := attrDefs["md5"]; hasMd5 && out.Attributes["md5"] == nil {
+				sum, err := fileMd5(path)
+				if err != nil {
+					return nil, fmt.Errorf("op pack '%s' %s '%s': %s", manifest.Name, out.Type, out.Name, err.Error())
+				}
+				out.Attributes["md5"] = sum
+			}
+		}
+		dirSum := ""
+		if dir, isDir := out.Attributes["source_dir"].(string); isDir && dir != "" {
+			if !filepath.IsAbs(dir) && baseDir != "" {
+				dir = filepath.Join(baseDir, dir)
+				out.Attributes["source_dir"] = dir
+			}
+			files, err := ListSourceDir(dir, sourceDirGlobs(out.Attributes["include"]), sourceDirGlobs(out.Attributes["exclude"]))
+			if err != nil {
+				return nil, fmt.Errorf("op pack '%s' %s '%s': %s", manifest.Name, out.Type, out.Name, err.Error())
+			}
+			dirSum = SourceDirChecksum(files)
+		}
+
+		js, err := json.Marshal(out)
+		if err != nil {
+			return nil, err
+		}
+		out.Hash = fmt.Sprintf("%x", sha256.Sum256(append(js, dirSum...)))
+		rendered = append(rendered, out)
+	}
+	if len(missing) > 0 {
+		names := []string{}
+		for name, _ := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("op pack '%s' needs values for variables: %s", manifest.Name, strings.Join(names, ", "))
+	}
+	return SortOpPackObjects(rendered, objects)
+}
+
+// Orders the objects so that each comes after the objects it depends on (see the top of this file),
+// and otherwise keeps the manifest order.
+func SortOpPackObjects(objs []opPackObject, objects map[string]interface{}) ([]opPackObject, error) {
+	deps := make([]map[int]bool, len(objs))
+	for i, obj := range objs {
+		deps[i] = map[int]bool{}
+		explicit := map[string]bool{}
+		for _, dep := range obj.DependsOn {
+			explicit[dep] = true
+		}
+		for j, other := range objs {
+			if i == j {
+				continue
+			}
+			if explicit[other.Name] || explicit[other.key()] {
+				deps[i][j] = true
+				continue
+			}
+			for key, val := range obj.Attributes {
+				refs, _ := GetNestedValueOrDefault(objects, ToKeyPath(obj.Type+".attributes."+key+".refs"), nil).(map[string]interface{})
+				if _, canRef := refs[other.Type]; canRef && ReferencesObject(val, other.Name) {
+					deps[i][j] = true
+					break
+				}
+			}
+		}
+		for dep, _ := range explicit {
+			found := false
+			for _, other := range objs {
+				found = found || dep == other.Name || dep == other.key()
+			}
+			if !found {
+				return nil, fmt.Errorf("%s '%s' depends on '%s', which isn't in the op pack", obj.Type, obj.Name, dep)
+			}
+		}
+	}
+
+	sorted := []opPackObject{}
+	done := make([]bool, len(objs))
+	for len(sorted) < len(objs) {
+		progress := false
+		for i, obj := range objs {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for j, _ := range deps[i] {
+				ready = ready && done[j]
+			}
+			if ready {
+				sorted = append(sorted, obj)
+				done[i] = true
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			cycle := []string{}
+			for i, obj := range objs {
+				if !done[i] {
+					cycle = append(cycle, obj.key())
+				}
+			}
+			return nil, fmt.Errorf("op pack objects have circular dependencies: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+func resourceShorelineOpPack(configJsStr string) *schema.Resource {
+	objects := map[string]interface{}{}
+	json.Unmarshal([]byte(configJsStr), &objects)
+	pack := &opPackInstaller{configJsStr: configJsStr, objects: objects, resources: map[string]*schema.Resource{}}
+	// built up front, as op packs may be planned and applied concurrently
+	for typ, object := range objects {
+		if _, hasAttrs := GetNestedValueOrDefault(object, ToKeyPath("attributes"), nil).(map[string]interface{}); typ != "docs" && hasAttrs {
+			pack.resources[typ] = resourceShorelineObject(configJsStr, typ)
+		}
+	}
+
+	return &schema.Resource{
+		Description: "Shoreline op pack. Installs a versioned bundle of objects (actions, alarms, bots, files, ...) from a manifest, in dependency order.\n\n" +
+			"Only the objects whose definition changed are updated on upgrade, objects dropped from the pack are deleted, " +
+			"and a failure partway through rolls back to the previously installed version. All objects are deleted on destroy.",
+
+		CreateContext: pack.create,
+		ReadContext:   pack.read,
+		UpdateContext: pack.update,
+		DeleteContext: pack.delete,
+		CustomizeDiff: pack.diff,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					if !ValidateVariableName(val.(string)) {
+						errs = append(errs, fmt.Errorf("%q must be a valid name (^[_a-zA-Z][_a-zA-Z0-9]*$),\n but got: %s", key, val.(string)))
+					}
+					return
+				},
+				Description: "The name of this installation of the pack (must be unique, e.g. to install a pack twice with different variables).",
+			},
+			"source_dir": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"source_dir", "manifest"},
+				Description:  "A directory with the pack's " + opPackManifestFile + ", and the files it refers to (relative `input_file` and `source_dir` paths are resolved against it).",
+			},
+			"manifest": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"source_dir", "manifest"},
+				Description:  "The pack's manifest as JSON, with name, version, variables and objects. Relative file paths are resolved against the working directory.",
+			},
+			"variables": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Values for the pack's variables, substituted for `${var.<name>}` in object names and attributes.",
+			},
+			"version": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The installed version of the pack.",
+			},
+			"object_hashes": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "A hash of each installed object's definition, keyed by `<type>:<name>`.",
+			},
+			"installed_manifest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The rendered definitions of the installed objects, used to roll back and uninstall.",
+			},
+		},
+	}
+}
+
+type opPackInstaller struct {
+	configJsStr string
+	objects     map[string]interface{}
+	// not modified after resourceShorelineOpPack(), so safe to share
+	resources map[string]*schema.Resource
+}
+
+// The generic resource that applies objects of a type (which RenderOpPack() checks is known).
+func (p *opPackInstaller) resource(typ string) *schema.Resource {
+	return p.resources[typ]
+}
+
+// Reads values from either a ResourceData or a ResourceDiff.
+type schemaGetter interface {
+	Get(string) interface{}
+	GetOk(string) (interface{}, bool)
+}
+
+// Reads and renders the configured pack.
+func (p *opPackInstaller) render(d schemaGetter) (*opPackManifest, []opPackObject, error) {
+	content := CastToString(d.Get("manifest"))
+	baseDir := ""
+	if dir, isDir := d.GetOk("source_dir"); isDir {
+		baseDir = dir.(string)
+		data, err := ioutil.ReadFile(filepath.Join(baseDir, opPackManifestFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read op pack manifest: %s", err.Error())
+		}
+		content = string(data)
+	}
+	manifest, err := ParseOpPackManifest(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, _ := d.Get("variables").(map[string]interface{})
+	rendered, err := RenderOpPack(manifest, values, baseDir, p.objects)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, rendered, nil
+}
+
+func (p *opPackInstaller) config(obj opPackObject) *terraform.ResourceConfig {
+	raw := DeepCopy(obj.Attributes).(map[string]interface{})
+	raw["name"] = obj.Name
+	return terraform.NewResourceConfigRaw(raw)
+}
+
+func opPackHashes(objs []opPackObject) map[string]interface{} {
+	hashes := map[string]interface{}{}
+	for _, obj := range objs {
+		hashes[obj.key()] = obj.Hash
+	}
+	return hashes
+}
+
+// Plans the version and object hashes, and checks each object's attributes against its resource schema.
+func (p *opPackInstaller) diff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	for _, key := range []string{"source_dir", "manifest", "variables"} {
+		if !d.NewValueKnown(key) {
+			d.SetNewComputed("version")
+			d.SetNewComputed("object_hashes")
+			return d.SetNewComputed("installed_manifest")
+		}
+	}
+	manifest, rendered, err := p.render(d)
+	if err != nil {
+		return err
+	}
+	for _, obj := range rendered {
+		diags := p.resource(obj.Type).Validate(p.config(obj))
+		for _, dg := range diags {
+			if dg.Severity == diag.Error {
+				return fmt.Errorf("op pack '%s' %s '%s': %s %s", manifest.Name, obj.Type, obj.Name, dg.Summary, dg.Detail)
+			}
+		}
+	}
+	if err := d.SetNew("version", manifest.Version); err != nil {
+		return err
+	}
+	hashes := opPackHashes(rendered)
+	old, _ := d.Get("object_hashes").(map[string]interface{})
+	if err := d.SetNew("object_hashes", hashes); err != nil {
+		return err
+	}
+	if d.Id() == "" || len(old) != len(hashes) {
+		return d.SetNewComputed("installed_manifest")
+	}
+	for key, hash := range hashes {
+		if old[key] != hash {
+			return d.SetNewComputed("installed_manifest")
+		}
+	}
+	return nil
+}
+
+func (p *opPackInstaller) createObject(ctx context.Context, meta interface{}, obj opPackObject) diag.Diagnostics {
+	res := p.resource(obj.Type)
+	diff, err := res.SimpleDiff(ctx, nil, p.config(obj), meta)
+	if err != nil {
+		return diag.Errorf("Failed to plan %s '%s': %s", obj.Type, obj.Name, err.Error())
+	}
+	d, _ := schema.InternalMap(res.Schema).Data(nil, diff)
+	return res.CreateContext(ctx, d, meta)
+}
+
+func (p *opPackInstaller) updateObject(ctx context.Context, meta interface{}, obj opPackObject) diag.Diagnostics {
+	res := p.resource(obj.Type)
+	current := res.Data(&terraform.InstanceState{ID: obj.Name, Attributes: map[string]string{"id": obj.Name, "name": obj.Name}})
+	diags := res.ReadContext(ctx, current, meta)
+	if diags.HasError() {
+		return diags
+	}
+	state := current.State()
+	diff, err := res.SimpleDiff(ctx, state, p.config(obj), meta)
+	if err != nil {
+		return diag.Errorf("Failed to plan %s '%s': %s", obj.Type, obj.Name, err.Error())
+	}
+	d, _ := schema.InternalMap(res.Schema).Data(state, diff)
+	return res.UpdateContext(ctx, d, meta)
+}
+
+func (p *opPackInstaller) deleteObject(ctx context.Context, meta interface{}, obj opPackObject) diag.Diagnostics {
+	res := p.resource(obj.Type)
+	d := res.Data(&terraform.InstanceState{ID: obj.Name, Attributes: map[string]string{"id": obj.Name, "name": obj.Name}})
+	return res.DeleteContext(ctx, d, meta)
+}
+
+// A change applied by install(), so it can be undone.
+type opPackStep struct {
+	action string // "create", "update" or "delete"
+	obj    opPackObject
+	prev   opPackObject
+}
+
+// Moves the installed objects from 'prev' to 'next' (both in install order).
+// On failure, the applied changes are undone in reverse. Only changes that succeeded are
+// undone: a failed create either made nothing (e.g. the name is taken by an object the
+// pack doesn't own) or already deleted its incomplete object, and a failed update is
+// already restored by the object resource.
+func (p *opPackInstaller) install(ctx context.Context, meta interface{}, pack string, prev []opPackObject, next []opPackObject) diag.Diagnostics {
+	prevByKey := map[string]opPackObject{}
+	for _, obj := range prev {
+		prevByKey[obj.key()] = obj
+	}
+	nextByKey := map[string]bool{}
+	for _, obj := range next {
+		nextByKey[obj.key()] = true
+	}
+
+	applied := []opPackStep{}
+	var diags diag.Diagnostics
+	for _, obj := range next {
+		old, installed := prevByKey[obj.key()]
+		if installed && old.Hash == obj.Hash {
+			continue
+		}
+		step := opPackStep{action: "create", obj: obj}
+		if installed {
+			appendActionLog(fmt.Sprintf("Op pack '%s': updating %s '%s'\n", pack, obj.Type, obj.Name))
+			diags = p.updateObject(ctx, meta, obj)
+			step = opPackStep{action: "update", obj: obj, prev: old}
+		} else {
+			appendActionLog(fmt.Sprintf("Op pack '%s': creating %s '%s'\n", pack, obj.Type, obj.Name))
+			diags = p.createObject(ctx, meta, obj)
+		}
+		if diags.HasError() {
+			break
+		}
+		applied = append(applied, step)
+	}
+	// dropped objects go last, as the remaining ones may have referenced them
+	for i := len(prev) - 1; i >= 0 && !diags.HasError(); i-- {
+		obj := prev[i]
+		if nextByKey[obj.key()] {
+			continue
+		}
+		appendActionLog(fmt.Sprintf("Op pack '%s': deleting %s '%s'\n", pack, obj.Type, obj.Name))
+		diags = p.deleteObject(ctx, meta, obj)
+		if !diags.HasError() {
+			applied = append(applied, opPackStep{action: "delete", obj: obj, prev: obj})
+		}
+	}
+	if !diags.HasError() {
+		return diags
+	}
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		step := applied[i]
+		var undo diag.Diagnostics
+		switch step.action {
+		case "create":
+			appendActionLog(fmt.Sprintf("Op pack '%s' (rollback): deleting %s '%s'\n", pack, step.obj.Type, step.obj.Name))
+			undo = p.deleteObject(ctx, meta, step.obj)
+		case "update":
+			appendActionLog(fmt.Sprintf("Op pack '%s' (rollback): restoring %s '%s'\n", pack, step.obj.Type, step.obj.Name))
+			undo = p.updateObject(ctx, meta, step.prev)
+		case "delete":
+			appendActionLog(fmt.Sprintf("Op pack '%s' (rollback): re-creating %s '%s'\n", pack, step.obj.Type, step.obj.Name))
+			undo = p.createObject(ctx, meta, step.prev)
+		}
+		if undo.HasError() {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  fmt.Sprintf("Failed to roll back op pack '%s' %s '%s' (it may need to be fixed manually).", pack, step.obj.Type, step.obj.Name),
+			})
+			diags = append(diags, undo...)
+		}
+	}
+	return diags
+}
+
+func (p *opPackInstaller) installed(d *schema.ResourceData) ([]opPackObject, error) {
+	objs := []opPackObject{}
+	js := CastToString(d.Get("installed_manifest"))
+	if js == "" {
+		return objs, nil
+	}
+	err := json.Unmarshal([]byte(js), &objs)
+	return objs, err
+}
+
+func (p *opPackInstaller) setInstalled(d *schema.ResourceData, version string, objs []opPackObject) diag.Diagnostics {
+	js, err := json.Marshal(objs)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("version", version)
+	d.Set("object_hashes", opPackHashes(objs))
+	d.Set("installed_manifest", string(js))
+	return nil
+}
+
+func (p *opPackInstaller) create(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	name := d.Get("name").(string)
+	manifest, rendered, err := p.render(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	appendActionLog(fmt.Sprintf("Installing op pack '%s': %s version %s\n", name, manifest.Name, manifest.Version))
+	diags := p.install(ctx, meta, name, nil, rendered)
+	if diags.HasError() {
+		return append(diag.Errorf("Failed to install op pack '%s' (%s version %s), rolled back.", name, manifest.Name, manifest.Version), diags...)
+	}
+	d.SetId(name)
+	return append(diags, p.setInstalled(d, manifest.Version, rendered)...)
+}
+
+// Drops objects that no longer exist from the installed state, so the next apply re-creates them.
+func (p *opPackInstaller) read(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	objs, err := p.installed(d)
+	if err != nil {
+		return diag.Errorf("Failed to parse installed op pack '%s': %s", d.Id(), err.Error())
+	}
+	existing := map[string]bool{}
+	present := []opPackObject{}
+	for _, obj := range objs {
+		if _, listed := existing[obj.Type+":"]; !listed {
+			names, err := listShorelineObjectNames(meta, obj.Type)
+			if err != nil {
+				return diag.Errorf("Failed to read op pack '%s': %s", d.Id(), err.Error())
+			}
+			existing[obj.Type+":"] = true
+			for _, n := range names {
+				existing[obj.Type+":"+n] = true
+			}
+		}
+		if !existing[obj.key()] {
+			appendActionLog(fmt.Sprintf("Reading op pack '%s': %s '%s' is missing\n", d.Id(), obj.Type, obj.Name))
+			continue
+		}
+		present = append(present, obj)
+	}
+	return p.setInstalled(d, CastToString(d.Get("version")), present)
+}
+
+func (p *opPackInstaller) update(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	name := d.Get("name").(string)
+	prev, err := p.installed(d)
+	if err != nil {
+		return diag.Errorf("Failed to parse installed op pack '%s': %s", name, err.Error())
+	}
+	prevVersion, _ := d.GetChange("version")
+	manifest, rendered, err := p.render(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	appendActionLog(fmt.Sprintf("Upgrading op pack '%s': %s version %v to %s\n", name, manifest.Name, prevVersion, manifest.Version))
+	diags := p.install(ctx, meta, name, prev, rendered)
+	if diags.HasError() {
+		d.Partial(true)
+		return append(diag.Errorf("Failed to upgrade op pack '%s' to %s version %s, rolled back to version %v.", name, manifest.Name, manifest.Version, prevVersion), diags...)
+	}
+	return append(diags, p.setInstalled(d, manifest.Version, rendered)...)
+}
+
+func (p *opPackInstaller) delete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	name := d.Get("name").(string)
+	objs, err := p.installed(d)
+	if err != nil {
+		return diag.Errorf("Failed to parse installed op pack '%s': %s", name, err.Error())
+	}
+	appendActionLog(fmt.Sprintf("Uninstalling op pack '%s'\n", name))
+	for i := len(objs) - 1; i >= 0; i-- {
+		diags := p.deleteObject(ctx, meta, objs[i])
+		if diags.HasError() {
+			// keep the remaining objects in the state, to retry
+			p.setInstalled(d, CastToString(d.Get("version")), objs[:i+1])
+			return diags
+		}
+	}
+	return nil
+}
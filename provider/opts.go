@@ -4,15 +4,11 @@
 package provider
 
 import (
-	"crypto/md5"
 	"crypto/rand"
-	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	zstd "github.com/klauspost/compress/zstd"
 	"github.com/spf13/viper"
 	"io"
-	"io/ioutil"
 	prand "math/rand"
 	"net/http"
 	"os"
@@ -20,6 +16,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -41,9 +38,13 @@ var AuthUrl string
 var AuthToken string
 var RetryLimit int
 var DoDebugLog = false
+var WaitForReady = false
+var FileCompressionLevel = fileCompressionLevelDefault
+var MaxInlineFileSize int64 = maxInlineFileSizeDefault
 var GlobalOpts = CliOpts{}
 
 var clientAuth *ClientAuth
+var clientAuthLock sync.Mutex
 
 var AuthConfig = viper.New()
 
@@ -236,18 +237,27 @@ func ExecuteOpCommand(GlobalOpts *CliOpts, expr string) (string, error) {
 	if !GlobalOpts.HasAuth {
 		return "", fmt.Errorf("No valid auth credentials.")
 	} else {
+		clientAuthLock.Lock()
 		if clientAuth == nil || clientAuth.BaseURL != GlobalOpts.Url || GlobalOpts.AuthChanged {
 			// Auth data is persisted, so that we don't have to re-authorize for every command
 			clientAuth = NewClientAuth(GlobalOpts.Url, GlobalOpts.Token, GetIdempotencyKey())
 			GlobalOpts.AuthChanged = false
-		} else {
-			// Fresh Idempotency key for every command.
-			clientAuth.ApiKey = GetIdempotencyKey()
 		}
+		// Fresh Idempotency key for every command (on a copy, as commands may run concurrently).
+		auth := *clientAuth
+		auth.ApiKey = GetIdempotencyKey()
+		clientAuthLock.Unlock()
 		fullExpr := expr
-		new_client := NewClient(clientAuth)
+		new_client := NewClient(&auth)
 		//fix this to be resolved input
 		ret, error := new_client.Execute(fullExpr, false)
+		// keep any refreshed access token for later commands
+		clientAuthLock.Lock()
+		if auth.AccessExpiry > clientAuth.AccessExpiry {
+			clientAuth.AccessToken = auth.AccessToken
+			clientAuth.AccessExpiry = auth.AccessExpiry
+		}
+		clientAuthLock.Unlock()
 		if error != nil {
 			inner := GetInnerError(error)
 			return "", fmt.Errorf(inner)
@@ -260,42 +270,12 @@ func ExecuteOpCommand(GlobalOpts *CliOpts, expr string) (string, error) {
 }
 
 // Returns base64 data, success/failure, file size, md5 checksum.
+// See EncodeFileData(), for the reason of failures.
 func FileToBase64(filename string, skipData bool) (string, bool, int64, string) {
-	encoded := ""
-	fstat, err := os.Stat(filename)
-	if err != nil || fstat.Size() == 0 { // skip non-existent or empty files
-		return "", false, 0, ""
-	}
-	fileLen := fstat.Size()
-	file, err := os.Open(filename)
-	if err != nil {
-		return "", false, 0, ""
-	}
-	defer file.Close()
-	// streaming md5sum
-	hash := md5.New()
-	_, err = io.Copy(hash, file)
+	encoded, fileLen, md5Sum, err := EncodeFileData(filename, skipData, FileCompressionLevel, MaxInlineFileSize)
 	if err != nil {
 		return "", false, 0, ""
 	}
-	md5Sum := fmt.Sprintf("%x", hash.Sum(nil))
-
-	if !skipData {
-		raw, err := ioutil.ReadFile(filename)
-		if err != nil {
-			//logging.WriteMsgColor(Red, "ERROR: Couldn't read input file: %s !\n", filename)
-			return "", false, 0, ""
-		}
-		// Create a writer that caches compressors.
-		// For this operation type we supply a nil Reader.
-		var encoder, _ = zstd.NewWriter(nil)
-
-		// Compress a buffer.
-		// If you have a destination buffer, the allocation in the call can also be eliminated.
-		compressed := encoder.EncodeAll(raw, make([]byte, 0, len(raw)))
-
-		encoded = base64.StdEncoding.EncodeToString(compressed)
-	}
 	return encoded, true, fileLen, md5Sum
 }
 
@@ -324,41 +304,6 @@ func DownloadFileHttps(src string, dst string, token string) error {
 	return nil
 }
 
-func UploadFileHttps(src string, dst string, token string) error {
-	file, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("couldn't open local upload file '%s'\n", src)
-	}
-	defer file.Close()
-
-	stat, err := os.Stat(src)
-	if err != nil {
-		return fmt.Errorf("Couldn't stat file to upload: " + err.Error())
-	}
-	fileSize := stat.Size()
-
-	reqOb, err := http.NewRequest("PUT", dst, file)
-	//reqOb, err := http.NewRequest("POST", dst, file)
-	//reqOb, err := http.NewRequest(http.MethodPut, dst, file)
-	if err != nil {
-		fmt.Printf("Couldn't create upload request object: " + err.Error())
-		return fmt.Errorf("Couldn't create upload request object: " + err.Error())
-	}
-	//reqOb.Header.Set("Content-Type", "application/octet-stream")
-	//reqOb.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	reqOb.ContentLength = fileSize
-
-	response, err := http.DefaultClient.Do(reqOb)
-	defer response.Body.Close()
-	if err != nil {
-		fmt.Printf("Couldn't upload file: " + err.Error())
-		return fmt.Errorf("Couldn't upload file: " + err.Error())
-	} else {
-		fmt.Printf("Uploaded file '%s' (%d bytes) status: %v - %v\n", src, fileSize, response.StatusCode, http.StatusText(response.StatusCode))
-	}
-	return nil
-}
-
 func DeleteFileHttps(dst string, token string) error {
 	resp, err := http.Get(dst)
 	if err != nil {
@@ -0,0 +1,161 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Backend-version specific object definition profiles.
+//
+// Attributes in ObjectConfigJsonStr may carry:
+//   "min_ver":   "X.Y.Z"                -- the field is unavailable on older backends
+//   "versions":  { "X.Y.Z": {...}, ... } -- metadata overrides (e.g. "alias_out", "step", "default")
+//                                          applied when the backend is at least "X.Y.Z"
+//   "alias_out": "name" | ["name", ...]  -- the field name(s) used when writing: the first one, and the
+//                                          others only if the backend doesn't know it (see isUnknownFieldError())
+//   "alias":     "name"                  -- fallback step/attribute when reading
+//
+// The backend version is detected once (per provider instance) and the profile for each object
+// type is resolved from it, so the CRUD functions only ever see a flat set of attributes.
+
+// Ops that only newer backends have, and the first backend version with each.
+// As for attributes, an unknown backend version is treated as the newest one.
+var opMinVersions = map[string]string{
+	remoteObjectConfigOp:  "14.2.0",
+	auditEventsOpName:     "14.2.0",
+	startFileUploadOpName: "14.2.0", // and complete_file_upload
+}
+
+// Fails with a "not supported" error if the backend is older than the first version with the op.
+func checkOpSupported(meta interface{}, op string, feature string) error {
+	minVer, hasMinVer := opMinVersions[op]
+	if !hasMinVer {
+		return nil
+	}
+	client, _ := meta.(*apiClient)
+	backendVersion := client.BackendVersion()
+	gtlteq, valid := CompareVersionRecords(backendVersion, ParseVersionString(minVer))
+	if valid && gtlteq < 0 {
+		return fmt.Errorf("%s is not supported by backend version '%s' (the '%s' op needs version '%s' or later)", feature, backendVersion.Version, op, minVer)
+	}
+	return nil
+}
+
+// Backend errors for a field name it doesn't know (e.g. a renamed one on an older backend).
+var unknownFieldErrors = []string{"field does not exist", "unknown field", "unknown attribute"}
+
+// Whether any attribute depends on the backend version.
+func attrsNeedVersion(attrs map[string]interface{}) bool {
+	for key, _ := range attrs {
+		if GetNestedValueOrDefault(attrs, ToKeyPath(key+".min_ver"), "").(string) != "" {
+			return true
+		}
+		if GetNestedValueOrDefault(attrs, ToKeyPath(key+".versions"), nil) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Flattens the versioned profile of each attribute for the given backend version.
+// Fields below their "min_ver" are marked "unavailable".
+// An unknown backend version is treated as the newest one.
+func ResolveAttrsForVersion(attrs map[string]interface{}, ver VersionRecord) map[string]interface{} {
+	resolved := map[string]interface{}{}
+	for key, attr := range attrs {
+		attrMap, isMap := attr.(map[string]interface{})
+		if !isMap {
+			resolved[key] = attr
+			continue
+		}
+		cur := map[string]interface{}{}
+		for k, v := range attrMap {
+			cur[k] = v
+		}
+
+		minVerStr, isStr := attrMap["min_ver"].(string)
+		if isStr && minVerStr != "" {
+			gtlteq, valid := CompareVersionRecords(ver, ParseVersionString(minVerStr))
+			if valid && gtlteq < 0 {
+				cur["unavailable"] = true
+			}
+		}
+
+		profiles, hasProfiles := attrMap["versions"].(map[string]interface{})
+		if hasProfiles {
+			profVers := []VersionRecord{}
+			for verStr, _ := range profiles {
+				profVers = append(profVers, ParseVersionString(verStr))
+			}
+			// apply in ascending order, so the newest applicable profile wins
+			sort.Slice(profVers, func(i, j int) bool {
+				cmp, _ := CompareVersionRecords(profVers[i], profVers[j])
+				return cmp < 0
+			})
+			for _, profVer := range profVers {
+				gtlteq, valid := CompareVersionRecords(ver, profVer)
+				if valid && gtlteq < 0 {
+					continue
+				}
+				overrides, isMap := profiles[profVer.Version].(map[string]interface{})
+				if !isMap {
+					continue
+				}
+				for k, v := range overrides {
+					cur[k] = v
+				}
+			}
+			delete(cur, "versions")
+		}
+		resolved[key] = cur
+	}
+	return resolved
+}
+
+// Returns the attributes of an object type as seen by the current backend.
+func resolveObjectAttrs(typ string, attrs map[string]interface{}, meta interface{}) (map[string]interface{}, VersionRecord) {
+	var backendVersion VersionRecord
+	backendVersion.Valid = false
+	if !attrsNeedVersion(attrs) {
+		return attrs, backendVersion
+	}
+	client, _ := meta.(*apiClient)
+	backendVersion = client.BackendVersion()
+	return ResolveAttrsForVersion(attrs, backendVersion), backendVersion
+}
+
+// Returns the list of field names to try when writing an attribute.
+func attrOutNames(attrs map[string]interface{}, key string) []string {
+	aliasOut := GetNestedValueOrDefault(attrs, ToKeyPath(key+".alias_out"), nil)
+	switch aliasOut.(type) {
+	case string:
+		return []string{aliasOut.(string)}
+	case []interface{}:
+		names := []string{}
+		for _, a := range aliasOut.([]interface{}) {
+			names = append(names, CastToString(a))
+		}
+		if len(names) > 0 {
+			return names
+		}
+	}
+	return []string{key}
+}
+
+// Whether a write failed only because the backend doesn't know the field name.
+func isUnknownFieldError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, e := range unknownFieldErrors {
+		if strings.Contains(msg, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -14,6 +14,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
@@ -24,6 +25,7 @@ import (
 // # import _ "embed"
 // # go:embed provider_conf.json
 // # var ObjectConfigJsonStr
+// NOTE: the config may also be loaded from the backend, see LoadObjectConfig()
 
 func CanonicalizeUrl(url string) (urlOut string, err error) {
 	urlRegexStr := `^(http(s)?://)?(?P<backend_node>([^\\.]*)\.)?(?P<customer>[^\\.]*)\.(?P<region>[^\\.]*)\.ap[ip]\.shoreline-(?P<cluster>[^\\.]*)\.io(/)?$`
@@ -171,7 +173,50 @@ func appendActionLog(msg string) {
 	if !DoDebugLog {
 		return
 	}
-	appendActionLogInner(msg)
+	appendActionLogInner(redactSensitiveValues(msg))
+}
+
+// Values of "sensitive" fields, which are redacted from the debug log.
+// Values shorter than sensitiveRedactMinLen are only redacted where they're assigned (e.g. 'x.key = "val"'
+// or 'key :: val'), as replacing them everywhere would garble unrelated text (e.g. names, or numbers).
+const sensitiveRedactMinLen = 8
+
+var sensitiveValues = struct {
+	sync.Mutex
+	vals map[string]bool
+}{vals: map[string]bool{}}
+
+func registerSensitiveValue(val interface{}) {
+	valStr := CastToString(val)
+	if valStr == "" {
+		return
+	}
+	sensitiveValues.Lock()
+	defer sensitiveValues.Unlock()
+	sensitiveValues.vals[valStr] = true
+}
+
+// Registers the values of an object's sensitive fields, before they can end up in the log.
+func registerSensitiveFields(attrs map[string]interface{}, d *schema.ResourceData) {
+	for key, _ := range attrs {
+		if GetNestedValueOrDefault(attrs, ToKeyPath(key+".sensitive"), false).(bool) {
+			registerSensitiveValue(d.Get(key))
+		}
+	}
+}
+
+func redactSensitiveValues(msg string) string {
+	sensitiveValues.Lock()
+	defer sensitiveValues.Unlock()
+	for val, _ := range sensitiveValues.vals {
+		if len(val) >= sensitiveRedactMinLen {
+			msg = strings.ReplaceAll(msg, val, "<sensitive>")
+			continue
+		}
+		assigned := regexp.MustCompile(`((?:=|::)\s*"?)` + regexp.QuoteMeta(val) + `("|\s|$)`)
+		msg = assigned.ReplaceAllString(msg, "${1}<sensitive>${2}")
+	}
+	return msg
 }
 
 func runOpCommand(command string, checkResult bool) (string, error) {
@@ -449,23 +494,34 @@ func dataSourceVersionRead(ctx context.Context, d *schema.ResourceData, m interf
 
 func New(version string) func() *schema.Provider {
 	return func() *schema.Provider {
+		// NOTE: optionally cached from the backend (see LoadObjectConfig)
+		objectConfig := LoadObjectConfig()
 		p := &schema.Provider{
 			//DataSourcesMap: map[string]*schema.Resource{
 			//	"shoreline_datasource": dataSourceShoreline(),
 			//},
 			ResourcesMap: map[string]*schema.Resource{
-				"shoreline_action":          resourceShorelineObject(ObjectConfigJsonStr, "action"),
-				"shoreline_alarm":           resourceShorelineObject(ObjectConfigJsonStr, "alarm"),
-				"shoreline_bot":             resourceShorelineObject(ObjectConfigJsonStr, "bot"),
-				"shoreline_circuit_breaker": resourceShorelineObject(ObjectConfigJsonStr, "circuit_breaker"),
-				"shoreline_file":            resourceShorelineObject(ObjectConfigJsonStr, "file"),
-				"shoreline_integration":     resourceShorelineObject(ObjectConfigJsonStr, "integration"),
-				"shoreline_metric":          resourceShorelineObject(ObjectConfigJsonStr, "metric"),
-				"shoreline_notebook":        resourceShorelineObject(ObjectConfigJsonStr, "notebook"),
-				"shoreline_principal":       resourceShorelineObject(ObjectConfigJsonStr, "principal"),
-				"shoreline_resource":        resourceShorelineObject(ObjectConfigJsonStr, "resource"),
+				"shoreline_action":          resourceShorelineObject(objectConfig, "action"),
+				"shoreline_action_run":      resourceShorelineActionRun(),
+				"shoreline_action_sequence": resourceShorelineObject(objectConfig, "action_sequence"),
+				"shoreline_alarm":           resourceShorelineObject(objectConfig, "alarm"),
+				"shoreline_bot":             resourceShorelineObject(objectConfig, "bot"),
+				"shoreline_circuit_breaker": resourceShorelineObject(objectConfig, "circuit_breaker"),
+				"shoreline_derived_metric":  resourceShorelineObject(objectConfig, "derived_metric"),
+				"shoreline_enablement":      resourceShorelineEnablement(objectConfig),
+				"shoreline_file":            resourceShorelineObject(objectConfig, "file"),
+				"shoreline_integration":     resourceShorelineObject(objectConfig, "integration"),
+				"shoreline_metric":          resourceShorelineObject(objectConfig, "metric"),
+				"shoreline_metric_set":      resourceShorelineObject(objectConfig, "metric_set"),
+				"shoreline_notebook":        resourceShorelineObject(objectConfig, "notebook"),
+				"shoreline_notebook_run":    resourceShorelineNotebookRun(objectConfig),
+				"shoreline_object_access":   resourceShorelineObjectAccess(objectConfig),
+				"shoreline_op_pack":         resourceShorelineOpPack(objectConfig),
+				"shoreline_principal":       resourceShorelineObject(objectConfig, "principal"),
+				"shoreline_resource":        resourceShorelineObject(objectConfig, "resource"),
 			},
 			DataSourcesMap: map[string]*schema.Resource{
+				"shoreline_audit_events": dataSourceShorelineAuditEvents(),
 				"shoreline_version": &schema.Resource{
 					ReadContext: dataSourceVersionRead,
 					Schema: map[string]*schema.Schema{
@@ -529,22 +585,55 @@ func New(version string) func() *schema.Provider {
 					Optional:    true,
 					Description: "Minimum version required on the Shoreline backend (API server).",
 				},
+				"wait_for_ready": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("SHORELINE_WAIT_FOR_READY", nil),
+					Description: "Wait (up to the create/update timeout) for objects to pass their readiness check after they are created or updated. Files wait until they are distributed to all their resources with the expected checksum, alarms until they are compiled, and bots until they are active.",
+				},
+				"file_compression_level": {
+					Type:        schema.TypeInt,
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("SHORELINE_FILE_COMPRESSION_LEVEL", fileCompressionLevelDefault),
+					ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+						if v := val.(int); v < 1 || v > 22 {
+							errs = append(errs, fmt.Errorf("%q must be between 1 and 22, got: %d", key, v))
+						}
+						return
+					},
+					Description: fmt.Sprintf("The zstd compression level (1 to 22) of file data sent inline, i.e. to backends without presigned uploads. "+
+						"Levels map to the encoder's speeds: 1-2 fastest, 3-5 default, and 6-22 better compression. Defaults to %d.", fileCompressionLevelDefault),
+				},
+				"max_inline_file_size": {
+					Type:        schema.TypeInt,
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("SHORELINE_MAX_INLINE_FILE_SIZE", maxInlineFileSizeDefault),
+					ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+						if v := val.(int); v < 0 {
+							errs = append(errs, fmt.Errorf("%q must be >= 0, got: %d", key, v))
+						}
+						return
+					},
+					Description: fmt.Sprintf("The largest file (in bytes) sent inline, i.e. to backends without presigned uploads, or 0 for no limit. Larger files fail with an error. Defaults to %d (64 MiB).", maxInlineFileSizeDefault),
+				},
 			},
 		}
 
-		p.ConfigureContextFunc = configure(version, p)
+		p.ConfigureContextFunc = configure(version, p, objectConfig)
 
 		return p
 	}
 }
 
 type apiClient struct {
-	// Add whatever fields, client or connection info, etc. here
-	// you would need to setup to communicate with the upstream
-	// API.
+	// remote objects, read once per run (see objectCache)
+	cache *objectCache
+	// backend version, detected on first use
+	versionLock    sync.Mutex
+	backendVersion *VersionRecord
 }
 
-func configure(version string, p *schema.Provider) func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+func configure(version string, p *schema.Provider, objectConfig string) func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 		AuthUrl = d.Get("url").(string)
 		token, hasToken := d.GetOk("token")
@@ -586,6 +675,16 @@ func configure(version string, p *schema.Provider) func(ctx context.Context, d *
 			DoDebugLog = debugLog.(bool)
 		}
 
+		waitForReady, hasWaitForReady := d.GetOk("wait_for_ready")
+		if hasWaitForReady {
+			WaitForReady = waitForReady.(bool)
+		} else {
+			WaitForReady = false
+		}
+
+		FileCompressionLevel = d.Get("file_compression_level").(int)
+		MaxInlineFileSize = int64(d.Get("max_inline_file_size").(int))
+
 		minVer, hasMinVer := d.GetOk("min_version")
 		if hasMinVer {
 			var diags diag.Diagnostics
@@ -617,7 +716,10 @@ func configure(version string, p *schema.Provider) func(ctx context.Context, d *
 			}
 		}
 
-		return &apiClient{}, diags
+		client := &apiClient{cache: newObjectCache()}
+		diags = append(diags, RefreshObjectConfig(objectConfig, client)...)
+
+		return client, diags
 	}
 }
 
@@ -781,24 +883,39 @@ func resourceShorelineObject(configJsStr string, key string) *schema.Resource {
 			}
 		case "resource":
 			sch.Type = schema.TypeString
-			// TODO ValidateResourceType() "^(HOST|POD|CONTAINER)$"
+			sch.ValidateFunc = func(val interface{}, key string) (warns []string, errs []error) {
+				if !ValidateResourceType(CastToString(val)) {
+					errs = append(errs, fmt.Errorf("%q must be one of (HOST, POD, CONTAINER), got: '%+v'", key, val))
+				}
+				return
+			}
+		}
+		// declarative rules (e.g. "enum", "regex") apply to each item of lists
+		metaValidate := attrMetaValidateFunc(attrMap)
+		if elem, isSchema := sch.Elem.(*schema.Schema); isSchema {
+			elem.ValidateFunc = metaValidate
+		} else {
+			sch.ValidateFunc = chainValidateFuncs(sch.ValidateFunc, metaValidate)
 		}
 		sch.Optional = GetNestedValueOrDefault(attrMap, ToKeyPath("optional"), false).(bool)
 		sch.Required = GetNestedValueOrDefault(attrMap, ToKeyPath("required"), false).(bool)
 		sch.Computed = GetNestedValueOrDefault(attrMap, ToKeyPath("computed"), false).(bool)
 		sch.ForceNew = GetNestedValueOrDefault(attrMap, ToKeyPath("forcenew"), false).(bool)
+		oneOf, _ := GetNestedValueOrDefault(attrMap, ToKeyPath("exactly_one_of"), nil).([]interface{})
+		for _, other := range oneOf {
+			sch.ExactlyOneOf = append(sch.ExactlyOneOf, CastToString(other))
+		}
 		deprecated := GetNestedValueOrDefault(attrMap, ToKeyPath("deprecated"), false).(bool)
 		deprField := GetNestedValueOrDefault(attrMap, ToKeyPath("deprecated_for"), "").(string)
 		if deprecated {
 			sch.Deprecated = fmt.Sprintf("Field '%s' is obsolete.", k)
 			sch.Description = "**Deprecated** " + sch.Deprecated + " " + description
 		}
+		// NOTE: a renamed field stays as a deprecated alias (written via its "versions" profile), so existing configs keep working
 		if deprField != "" {
 			sch.Deprecated = fmt.Sprintf("Please use '%s' instead.", deprField)
 			sch.ConflictsWith = []string{deprField}
 			sch.Description = "**Deprecated** " + sch.Deprecated + " " + description
-			// XXX does this need diff suppression?
-			//sch.DiffSuppressFunc = func(k, old, nu string, d *schema.ResourceData) bool { }
 		}
 		replacesField := GetNestedValueOrDefault(attrMap, ToKeyPath("replaces"), "").(string)
 		if replacesField != "" {
@@ -846,6 +963,32 @@ func resourceShorelineObject(configJsStr string, key string) *schema.Resource {
 			}
 		}
 
+		sch.Sensitive = GetNestedValueOrDefault(attrMap, ToKeyPath("sensitive"), false).(bool)
+		writeOnly := GetNestedValueOrDefault(attrMap, ToKeyPath("write_only"), false).(bool)
+		if writeOnly {
+			// never stored in the state, so only sent on create, or when "rotate_with" changes
+			rotateWith := GetNestedValueOrDefault(attrMap, ToKeyPath("rotate_with"), "").(string)
+			sch.Sensitive = true
+			sch.Description += " Write-only: it is not stored in the state, and only sent when the object is created"
+			if rotateWith != "" {
+				sch.Description += fmt.Sprintf(", or when `%s` changes", rotateWith)
+			}
+			sch.Description += "."
+			sch.DiffSuppressFunc = func(k, old, nu string, d *schema.ResourceData) bool {
+				if d.Id() == "" {
+					return false
+				}
+				if rotateWith != "" && d.HasChange(rotateWith) {
+					return false
+				}
+				if oldName, _ := d.GetChange("name"); oldName != "" && d.HasChange("name") {
+					// renames may re-create the object
+					return false
+				}
+				return true
+			}
+		}
+
 		// NOTE: This actually messes up the file objects. Need a suppress function that's just for acceptance test comparisions.
 		//notStored, isBool := GetNestedValueOrDefault(attrMap, ToKeyPath("not_stored"), nil).(bool)
 		//if isBool && notStored {
@@ -866,15 +1009,46 @@ func resourceShorelineObject(configJsStr string, key string) *schema.Resource {
 	}
 
 	objDescription := CastToString(GetNestedValueOrDefault(objects, ToKeyPath("docs.objects."+key), ""))
+	ready, _ := GetNestedValueOrDefault(object, ToKeyPath("ready"), nil).(map[string]interface{})
+	referrers := objectReferrerTypes(objects, key)
+	rename, _ := GetNestedValueOrDefault(object, ToKeyPath("rename"), nil).(map[string]interface{})
+	// a "forcenew" name is only replaced if the backend can't rename in place (see resourceShorelineObjectDiff())
+	copyUnsafe := false
+	if nameSch, hasName := params["name"]; hasName && nameSch.ForceNew {
+		copyUnsafe = true
+		nameSch.ForceNew = rename == nil
+	}
+
+	// local-only, see deleteShorelineObjectWithRefs()
+	params["force_destroy"] = &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+		Default:  false,
+		Description: "On delete, first disable or detach any objects that still reference this one (e.g. bots, circuit breakers or actions' file_deps). " +
+			"Referencing objects are never deleted: those that can't be disabled or detached (e.g. action sequences, or derived metrics) are reported, to be changed or removed first.",
+	}
+	// see setExtraAttributes()
+	params["extra_attributes"] = extraAttributesSchema(attributes)
+
+	// local-only, see resourceShorelineObjectDiff()
+	if !copyUnsafe || rename != nil {
+		params["rename_note"] = &schema.Schema{
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "How the last change of `name` was applied: renamed in place, or copied to the new name (with referencing objects updated) and the old object deleted.",
+		}
+	}
 
 	return &schema.Resource{
 		Description: "Shoreline " + key + ". " + objDescription,
 
-		CreateContext: resourceShorelineObjectCreate(key, primary, attributes),
+		CreateContext: resourceShorelineObjectCreate(key, primary, attributes, ready),
 		ReadContext:   resourceShorelineObjectRead(key, attributes),
-		UpdateContext: resourceShorelineObjectUpdate(key, attributes),
-		DeleteContext: resourceShorelineObjectDelete(key),
-		Importer:      &schema.ResourceImporter{State: schema.ImportStatePassthrough},
+		UpdateContext: resourceShorelineObjectUpdate(key, primary, attributes, ready, rename, referrers),
+		DeleteContext: resourceShorelineObjectDelete(key, attributes, referrers),
+		Importer:      &schema.ResourceImporter{StateContext: resourceShorelineObjectImport},
+		CustomizeDiff: resourceShorelineObjectDiff(key, attributes, object, rename, copyUnsafe),
+		Timeouts:      resourceShorelineObjectTimeouts(),
 
 		Schema: params,
 	}
@@ -1064,30 +1238,28 @@ func setFieldViaOp(typ string, attrs map[string]interface{}, name string, key st
 	valStr := attrValueString(typ, key, val, attrs)
 	appendActionLog(fmt.Sprintf("Setting %s field: '%s'.'%s' :: %+v\n", typ, name, key, val))
 
-	op := fmt.Sprintf("%s.%s = %s", name, key, valStr)
-
-	// TODO Let alias to be a list of fallbacks for versioning,
-	//   or have alternate ObjectConfigJsonStr based on backend version,
-	//   or let backend return ObjectConfigJsonStr to use.
-	alias, isStr := GetNestedValueOrDefault(attrs, ToKeyPath(key+".alias_out"), nil).(string)
-	if isStr {
-		//appendActionLog(fmt.Sprintf("Setting %s aliased field: '%s'->'%s'.'%s' :: %+v\n", typ, name, alias, key, val))
-		op = fmt.Sprintf("%s.%s = %s", name, alias, valStr)
-	}
+	// The field name is picked by the backend version's profile (see ResolveAttrsForVersion()),
+	// and the other aliases are only tried if the backend doesn't know it (e.g. its version is off).
+	for _, outName := range attrOutNames(attrs, key) {
+		op := fmt.Sprintf("%s.%s = %s", name, outName, valStr)
 
-	appendActionLog(fmt.Sprintf("Setting with op statement... '%s'\n", op))
-	result, err := runOpCommand(op, true)
-	if err != nil {
-		diags = diag.Errorf("Failed to set %s %s.%s: %s", typ, name, key, err.Error())
-		appendActionLog(fmt.Sprintf("Failed to set %s %s.%s: %s\nval: (( %+v ))\nop-statement: %s\n", typ, name, key, val, err.Error(), op))
-		return diags
-	}
-	err = CheckUpdateResult(result)
-	if err != nil {
-		diags = diag.Errorf("Failed to update %s %s.%s: %s", typ, name, key, err.Error())
-		return diags
+		appendActionLog(fmt.Sprintf("Setting with op statement... '%s'\n", op))
+		result, err := runOpCommand(op, true)
+		if err == nil {
+			err = CheckUpdateResult(result)
+			if err == nil {
+				return nil
+			}
+			diags = diag.Errorf("Failed to update %s %s.%s: %s", typ, name, key, err.Error())
+		} else {
+			diags = diag.Errorf("Failed to set %s %s.%s: %s", typ, name, key, err.Error())
+		}
+		appendActionLog(fmt.Sprintf("Failed to set %s %s.%s: %s\nval: (( %+v ))\nop-statement: %s\n", typ, name, key, err.Error(), val, op))
+		if !isUnknownFieldError(err) {
+			break
+		}
 	}
-	return nil
+	return diags
 }
 
 func getRemoteFileAttr(name string, key string) string {
@@ -1140,13 +1312,6 @@ func setFieldInner(key string, val interface{}, name string, typ string, attrs m
 		result = setFieldViaOp(typ, attrs, name, key, forcedChangeVals[key])
 	} else {
 		result = setFieldViaOp(typ, attrs, name, key, val)
-
-		// on failure, if field is deprecated and renamed, try the new name
-		deprecatedFor := GetNestedValueOrDefault(attrs, ToKeyPath(key+".deprecated_for"), "").(string)
-		if deprecatedFor != "" && result != nil {
-			appendActionLog(fmt.Sprintf("Set deprecated/renamed field : %s: '%s'.'%s'->'%s'  val:'%v'\n", typ, name, key, deprecatedFor, val))
-			result = setFieldViaOp(typ, attrs, name, deprecatedFor, val)
-		}
 	}
 	if result != nil {
 		return false, result
@@ -1154,6 +1319,18 @@ func setFieldInner(key string, val interface{}, name string, typ string, attrs m
 	return true, nil
 }
 
+// The other name of a renamed field ("deprecated_for" or "replaces"), if that's the one in use.
+// Both names are the same backend field (via the "versions" profile), so only the one in use is read and written.
+func renamedFieldInUse(key string, attrs map[string]interface{}, d *schema.ResourceData) string {
+	for _, rel := range []string{"deprecated_for", "replaces"} {
+		other := GetNestedValueOrDefault(attrs, ToKeyPath(key+"."+rel), "").(string)
+		if _, otherSet := d.GetOk(other); other != "" && otherSet {
+			return other
+		}
+	}
+	return ""
+}
+
 func shouldSkipSetField(key string, val interface{}, name string, typ string, attrs map[string]interface{}, ctx context.Context, d *schema.ResourceData, meta interface{}, doDiff bool, isCreate bool, forcedChangeKeys map[string]bool, forcedChangeVals map[string]interface{}, backendVersion VersionRecord) (bool, diag.Diagnostics) {
 	skip := GetNestedValueOrDefault(attrs, ToKeyPath(key+".skip"), false).(bool)
 	if skip {
@@ -1171,48 +1348,53 @@ func shouldSkipSetField(key string, val interface{}, name string, typ string, at
 		appendActionLog(fmt.Sprintf("Set (skipping proxy): %s: '%s'.'%s'\n", typ, name, key))
 		return true, nil
 	}
+	// e.g. a deprecated name being unset, to move to the new one, mustn't clear it
+	if other := renamedFieldInUse(key, attrs, d); other != "" {
+		appendActionLog(fmt.Sprintf("Set (skipping renamed, for '%s'): %s: '%s'.'%s'\n", other, typ, name, key))
+		return true, nil
+	}
 
-	min_ver := GetNestedValueOrDefault(attrs, ToKeyPath(key+".min_ver"), "").(string)
-	if min_ver != "" {
-		minVer := ParseVersionString(min_ver)
-		// XXX check minVer.Error and complain about version string
-		gtlteq, valid := CompareVersionRecords(backendVersion, minVer)
-		if valid && gtlteq < 0 {
-			// NOTE: see below for errata on GetOk().exists
-			val, exists := d.GetOk(key)
-			defowlt := GetNestedValueOrDefault(attrs, ToKeyPath(key+".default"), nil)
-			if defowlt == nil {
-				attrTyp := GetNestedValueOrDefault(attrs, ToKeyPath(key+".type"), "string").(string)
-				defowlt = attrValueDefault(attrTyp)
-			}
-			appendActionLog(fmt.Sprintf("Set (checking min_ver): %s: '%s'.'%s' exists(%v) val(%v) default(%v) ver(%v) backend_ver(%v)\n", typ, name, key, exists, val, defowlt, min_ver, backendVersion.Version))
-			// NOTE: because of the bug in GetOk(), we can't know for sure if the value is set in the TF HCL
-			//   e.g. value=<unset>, default=true -> exists==true
-			//        value=false,   default=true -> exists==false
-			// So, be conservative, and only complain if it's different than the default:
-			if val != nil && val != defowlt {
-				// XXX error or warning? (Hashi plugin SDK v2 doesn't seem to support warnings)
-				//diags.AddWarning("Below minimum version.", fmt.Sprintf("Field %s.%s requires minimum version %s, skipping...", name, key, min_ver))
-				diags := diag.Errorf("Field '%s.%s' requires minimum version '%s', but backend is '%s'", name, key, min_ver, backendVersion.Version)
-				return false, diags
-			}
-			appendActionLog(fmt.Sprintf("Set (skipping): %s: '%s'.'%s' exists(%v) val(%v) default(%v) ver(%v) backend_ver(%v)\n", typ, name, key, exists, val, defowlt, min_ver, backendVersion.Version))
-			return true, nil
-		}
+	// fields below their "min_ver" are flagged by ResolveAttrsForVersion()
+	unavailable := GetNestedValueOrDefault(attrs, ToKeyPath(key+".unavailable"), false).(bool)
+	if unavailable {
+		min_ver := GetNestedValueOrDefault(attrs, ToKeyPath(key+".min_ver"), "").(string)
+		// NOTE: see below for errata on GetOk().exists
+		val, exists := d.GetOk(key)
+		defowlt := GetNestedValueOrDefault(attrs, ToKeyPath(key+".default"), nil)
+		if defowlt == nil {
+			attrTyp := GetNestedValueOrDefault(attrs, ToKeyPath(key+".type"), "string").(string)
+			defowlt = attrValueDefault(attrTyp)
+		}
+		appendActionLog(fmt.Sprintf("Set (checking min_ver): %s: '%s'.'%s' exists(%v) val(%v) default(%v) ver(%v) backend_ver(%v)\n", typ, name, key, exists, val, defowlt, min_ver, backendVersion.Version))
+		// NOTE: because of the bug in GetOk(), we can't know for sure if the value is set in the TF HCL
+		//   e.g. value=<unset>, default=true -> exists==true
+		//        value=false,   default=true -> exists==false
+		// So, be conservative, and only complain if it's different than the default:
+		if val != nil && val != defowlt {
+			// XXX error or warning? (Hashi plugin SDK v2 doesn't seem to support warnings)
+			//diags.AddWarning("Below minimum version.", fmt.Sprintf("Field %s.%s requires minimum version %s, skipping...", name, key, min_ver))
+			diags := diag.Errorf("Field '%s.%s' requires minimum version '%s', but backend is '%s'", name, key, min_ver, backendVersion.Version)
+			return false, diags
+		}
+		appendActionLog(fmt.Sprintf("Set (skipping): %s: '%s'.'%s' exists(%v) val(%v) default(%v) ver(%v) backend_ver(%v)\n", typ, name, key, exists, val, defowlt, min_ver, backendVersion.Version))
+		return true, nil
 	}
 	return false, nil
 }
 
-func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{}, ctx context.Context, d *schema.ResourceData, meta interface{}, doDiff bool, isCreate bool) diag.Diagnostics {
+// Writes the object's fields to the backend. A failed field doesn't stop the others,
+// and every failure is reported. The keys that were written are recorded in 'written' (if non-nil).
+func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{}, ctx context.Context, d *schema.ResourceData, meta interface{}, doDiff bool, isCreate bool, written map[string]bool) diag.Diagnostics {
 	var diags diag.Diagnostics
 	name := d.Get("name").(string)
+	attrs, backendVersion := resolveObjectAttrs(typ, attrs, meta)
 	// valid-variable-name check (and non-null)
 	//appendActionLog(fmt.Sprintf("RESOURCE TYPE IS: %s\n", typ))
 
-	needVersion := false
 	writeEnable := false
 	enableVal := false
 	anyChange := false
+	var failed diag.Diagnostics
 	// fields that have to be explicitly set (e.g. notebook fields both in JSON and explicit TF)
 	forcedUpdate := map[string]bool{}
 	// computed file properties
@@ -1227,31 +1409,50 @@ func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{},
 				forcedChangeKeys[k] = true
 			}
 		}
-		min_ver := GetNestedValueOrDefault(attrs, ToKeyPath(key+".min_ver"), "").(string)
-		if min_ver != "" {
-			needVersion = true
-		}
-	}
-
-	var backendVersion VersionRecord
-	backendVersion.Valid = false
-	if needVersion {
-		backendVersion = GetBackendVersionInfoStruct()
 	}
 
 	if typ == "file" {
 		infile, exists := d.GetOk("input_file")
+		// a source_dir is packed, and uploaded as a single tarball,
+		// and inline content is uploaded like an input_file
+		packed, dirSum := false, ""
+		if dir, hasDir := d.GetOk("source_dir"); hasDir {
+			tarball, _, sum, err := PackSourceDir(dir.(string), sourceDirGlobs(d.Get("include")), sourceDirGlobs(d.Get("exclude")))
+			if err != nil {
+				diags = diag.Errorf("Failed to pack source_dir of file object %s -- %s", name, err.Error())
+				return diags
+			}
+			defer os.Remove(tarball)
+			infile, exists, packed, dirSum = tarball, true, true, sum
+		} else if data, isContent, err := fileContent(d); isContent {
+			if err != nil {
+				diags = diag.Errorf("Failed to read content of file object %s -- %s", name, err.Error())
+				return diags
+			}
+			tmpFile, err := writeFileContent(data)
+			if err != nil {
+				diags = diag.Errorf("Failed to write content of file object %s -- %s", name, err.Error())
+				return diags
+			}
+			defer os.Remove(tmpFile)
+			infile, exists = tmpFile, true
+		}
 		if exists {
 			uri := getRemoteFileAttr(name, "uri")
 			fileIsRemote := true
 			if uri == "" {
 				fileIsRemote = false
 			}
-			base64Data, ok, fileSize, md5sum := FileToBase64(infile.(string), fileIsRemote)
+			base64Data, fileSize, md5sum, err := EncodeFileData(infile.(string), fileIsRemote, FileCompressionLevel, MaxInlineFileSize)
 			if fileIsRemote {
 				base64Data = fmt.Sprintf(":%s", uri)
 			}
-			if ok {
+			// the uploaded data is checked against its own md5
+			dataSum := md5sum
+			if packed {
+				md5sum = dirSum
+			}
+			if err == nil {
 				appendActionLog(fmt.Sprintf("file_length is %d (%v)\n", int(fileSize), fileSize))
 				if forcedChangeKeys["file_data"] {
 					forcedChangeVals["file_length"] = int(fileSize)
@@ -1262,19 +1463,14 @@ func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{},
 				d.Set("checksum", md5sum)
 				d.Set("file_data", base64Data)
 				if fileIsRemote {
-					presignedUrl := getRemoteFileAttr(name, "presigned_put")
-					if presignedUrl == "" {
-						diags = diag.Errorf("Failed to get presigned url for file object %s", name)
-						return diags
-					}
-					err := UploadFileHttps(infile.(string), presignedUrl, "")
+					err := uploadFileObject(ctx, meta, name, infile.(string), dataSum, fileSize)
 					if err != nil {
 						diags = diag.Errorf("Failed to upload to presigned url for file object %s -- %s", name, err.Error())
 						return diags
 					}
 				}
 			} else {
-				diags = diag.Errorf("Failed to read file object %s", infile)
+				diags = diag.Errorf("Failed to read file object %s -- %s", name, err.Error())
 				return diags
 			}
 		}
@@ -1317,16 +1513,9 @@ func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{},
 		}
 	}
 	if typ == "notebook" {
-		// XXX Hack: work around backend issue with wacky data-dependent ordering
 		aVal, _ := d.Get("allowed_entities").([]interface{})
 		//appendActionLog(fmt.Sprintf("Notebook allowed_entities has len: %v\n", len(aVal)))
-		if len(aVal) > 0 {
-			orderedAttrs = append(orderedAttrs, "allowed_entities")
-			orderedAttrs = append(orderedAttrs, "approvers")
-		} else {
-			orderedAttrs = append(orderedAttrs, "approvers")
-			orderedAttrs = append(orderedAttrs, "allowed_entities")
-		}
+		orderedAttrs = append(orderedAttrs, accessListOrder(len(aVal) > 0)...)
 	}
 
 	for _, key := range orderedAttrs {
@@ -1344,6 +1533,10 @@ func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{},
 			// set first above, skip here
 			continue
 		}
+		if GetNestedValueOrDefault(attrs, ToKeyPath(key+".param"), "").(string) != "" {
+			// packed below
+			continue
+		}
 
 		forceSet := false
 		// CS-336 workaround: Force explicit set of action_statement/alarm_statement to patch quoting issue
@@ -1376,6 +1569,7 @@ func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{},
 
 		// Because OpLang auto-toggles some objects to "disabled" on *any* property change,
 		// we have to restore the value as needed.
+		// NOTE: when unset, 'enabled' is computed, so val is the current state, and is kept.
 		if key == "enabled" {
 			enableVal, _ = CastToBoolMaybe(val)
 			if d.HasChange(key) || !doDiff {
@@ -1388,86 +1582,130 @@ func resourceShorelineObjectSetFields(typ string, attrs map[string]interface{},
 			continue
 		}
 
-		changed, diags := setFieldInner(key, val, name, typ, attrs, ctx, d, meta, doDiff, isCreate, forcedChangeKeys, forcedChangeVals)
-		if diags != nil {
-			return diags
+		if written != nil {
+			written[key] = true
+		}
+		changed, fieldDiags := setFieldInner(key, val, name, typ, attrs, ctx, d, meta, doDiff, isCreate, forcedChangeKeys, forcedChangeVals)
+		if fieldDiags != nil {
+			// keep going, so that all failed fields are reported
+			failed = append(failed, fieldDiags...)
+			continue
 		}
 		if changed {
 			anyChange = true
 		}
 	}
+	paramsChanged, paramsDiags := setObjectParams(meta, typ, attrs, name, d, doDiff, isCreate, written)
+	failed = append(failed, paramsDiags...)
+	if paramsChanged {
+		anyChange = true
+	}
+	extraChanged, extraDiags := setExtraAttributes(typ, name, d, doDiff)
+	failed = append(failed, extraDiags...)
+	if extraChanged {
+		anyChange = true
+	}
+	if failed != nil {
+		return failed
+	}
 
 	appendActionLog(fmt.Sprintf("EnableState: %s: '%s' write(%v) val(%v) change(%v)\n", typ, name, writeEnable, enableVal, anyChange))
 	// Enabled is automatically toggled to "false" by oplang on any other attribute change.
 	// So, it requires special handling.
 	if writeEnable || (enableVal && anyChange) {
-		act := "enable"
-		if !enableVal {
-			act = "disable"
-		}
-		op := fmt.Sprintf("%s %s", act, name)
-		appendActionLog(fmt.Sprintf("EnableState: %s: '%s' Op:'%s'\n", typ, name, op))
-		result, err := runOpCommand(op, true)
-		if err != nil {
-			diags = diag.Errorf("Failed to %s (1) %s: %s", act, typ, err.Error())
-			return diags
-		}
-		err = CheckUpdateResult(result)
-		if err != nil {
-			diags = diag.Errorf("Failed to %s (2) %s: %s", act, typ, err.Error())
-			return diags
-		}
+		return setObjectEnabled(typ, name, enableVal)
 	}
 	return nil
 }
 
-func resourceShorelineObjectCreate(typ string, primary string, attrs map[string]interface{}) func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+// Enables or disables a named object.
+func setObjectEnabled(typ string, name string, enabled bool) diag.Diagnostics {
+	act := "enable"
+	if !enabled {
+		act = "disable"
+	}
+	op := fmt.Sprintf("%s %s", act, name)
+	appendActionLog(fmt.Sprintf("EnableState: %s: '%s' Op:'%s'\n", typ, name, op))
+	result, err := runOpCommand(op, true)
+	if err != nil {
+		return diag.Errorf("Failed to %s (1) %s: %s", act, typ, err.Error())
+	}
+	err = CheckUpdateResult(result)
+	if err != nil {
+		return diag.Errorf("Failed to %s (2) %s: %s", act, typ, err.Error())
+	}
+	return nil
+}
+
+func resourceShorelineObjectCreate(typ string, primary string, attrs map[string]interface{}, ready map[string]interface{}) func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 		// use the meta value to retrieve your client from the provider configure method
 		// client := meta.(*apiClient)
 
-		var diags diag.Diagnostics
 		name := d.Get("name").(string)
-		primaryVal := d.Get(primary)
-		idFromAPI := name
-		appendActionLog(fmt.Sprintf("Creating %s: '%s' (%v) :: %+v\n", typ, idFromAPI, name, d))
-
-		primaryValStr := attrValueString(typ, primary, primaryVal, attrs)
-		//appendActionLog(fmt.Sprintf("primaryValStr is ((( %+v )))\n", primaryValStr))
-		//op := fmt.Sprintf("%s %s = \"%s\"", typ, name, primaryVal)
-		op := fmt.Sprintf("%s %s = %s", typ, name, primaryValStr)
-		//if typ == "bot" {
-		//	// special handling for BOT creation statement "bot <name>=
-		//	action := d.Get("action_statement").(string)
-		//	alarm := d.Get("alarm_statement").(string)
-		//	op = fmt.Sprintf("%s %s = if %s then %s fi", typ, name, alarm, action)
-		//}
-		result, err := runOpCommand(op, true)
-		if err != nil {
-			// TODO check if already exists
-			diags = diag.Errorf("Failed to create (1) %s: %s", typ, err.Error())
-			return diags
-		}
-		err = CheckUpdateResult(result)
-		if err != nil {
-			diags = diag.Errorf("Failed to create (2) %s: %s", typ, err.Error())
-			return diags
-		}
+		registerSensitiveFields(attrs, d)
+		appendActionLog(fmt.Sprintf("Creating %s: '%s' (%v) :: %+v\n", typ, name, name, d))
 
-		diags = resourceShorelineObjectSetFields(typ, attrs, ctx, d, meta, false, true)
+		diags := createShorelineObject(ctx, d, meta, typ, primary, attrs)
 		if diags != nil {
-			// delete incomplete object
-			resourceShorelineObjectDelete(typ)(ctx, d, meta)
 			return diags
 		}
 
 		// once the object is ok, set the ID to tell terraform it's valid...
 		d.SetId(name)
+
+		// e.g. files may not be distributed to their resources yet
+		diags = waitForShorelineObjectReady(ctx, typ, ready, d, d.Timeout(schema.TimeoutCreate))
+		if diags != nil {
+			return diags
+		}
 		// update the data in terraform
 		return resourceShorelineObjectRead(typ, attrs)(ctx, d, meta)
 	}
 }
 
+// Creates the object from its primary field, then sets the other fields (deleting it if that fails).
+func createShorelineObject(ctx context.Context, d *schema.ResourceData, meta interface{}, typ string, primary string, attrs map[string]interface{}) diag.Diagnostics {
+	name := d.Get("name").(string)
+	primaryVal := d.Get(primary)
+
+	diags := checkShorelineObjectReferences(meta, typ, attrs, d, false)
+	if diags != nil {
+		return diags
+	}
+
+	primaryValStr := attrValueString(typ, primary, primaryVal, attrs)
+	//appendActionLog(fmt.Sprintf("primaryValStr is ((( %+v )))\n", primaryValStr))
+	//op := fmt.Sprintf("%s %s = \"%s\"", typ, name, primaryVal)
+	op := fmt.Sprintf("%s %s = %s", typ, name, primaryValStr)
+	//if typ == "bot" {
+	//	// special handling for BOT creation statement "bot <name>=
+	//	action := d.Get("action_statement").(string)
+	//	alarm := d.Get("alarm_statement").(string)
+	//	op = fmt.Sprintf("%s %s = if %s then %s fi", typ, name, alarm, action)
+	//}
+	result, err := runOpCommand(op, true)
+	if err != nil {
+		// TODO check if already exists
+		diags = diag.Errorf("Failed to create (1) %s: %s", typ, err.Error())
+		return diags
+	}
+	err = CheckUpdateResult(result)
+	if err != nil {
+		diags = diag.Errorf("Failed to create (2) %s: %s", typ, err.Error())
+		return diags
+	}
+	invalidateCachedObject(meta, typ, name)
+
+	diags = resourceShorelineObjectSetFields(typ, attrs, ctx, d, meta, false, true, nil)
+	if diags != nil {
+		// delete incomplete object
+		deleteShorelineObject(typ, name)
+		return diags
+	}
+	return nil
+}
+
 // returns skip, value, diagnostics
 func resourceShorelineObjectReadSingleAttr(name string, typ string, key string, attrs map[string]interface{}, record map[string]interface{}, stepsJs map[string]interface{}, d *schema.ResourceData) (bool, interface{}, diag.Diagnostics) {
 	var val interface{}
@@ -1484,6 +1722,13 @@ func resourceShorelineObjectReadSingleAttr(name string, typ string, key string,
 		return true, nil, nil
 	}
 
+	notStored := GetNestedValueOrDefault(attrs, ToKeyPath(key+".not_stored"), false).(bool)
+	writeOnly := GetNestedValueOrDefault(attrs, ToKeyPath(key+".write_only"), false).(bool)
+	if notStored || writeOnly {
+		// local-only (e.g. input_file), or never read back (e.g. credentials)
+		return true, nil, nil
+	}
+
 	compoundValue, isStr := GetNestedValueOrDefault(attrs, ToKeyPath(key+".compound_out"), nil).(string)
 	if isStr {
 		fullVal := compoundValue
@@ -1614,10 +1859,107 @@ func resourceShorelineObjectReadSingleAttr(name string, typ string, key string,
 		} else {
 			val = GetNestedValueOrDefault(record, ToKeyPath("attributes."+key), nil)
 		}
+
+		// the field may be named differently on this backend version
+		alias, isStr := GetNestedValueOrDefault(attr, ToKeyPath("alias"), nil).(string)
+		if val == nil && isStr && alias != "" {
+			appendActionLog(fmt.Sprintf("Reading aliased field : %s: '%s'.'%s'->'%s'\n", typ, name, key, alias))
+			if stepPath != "" {
+				val = GetNestedValueOrDefault(stepsJs, ToKeyPath(alias), nil)
+			} else {
+				val = GetNestedValueOrDefault(record, ToKeyPath("attributes."+alias), nil)
+			}
+		}
 	}
 	return false, val, nil
 }
 
+// Unpacks string-encoded JSON fields of an object's class (e.g. integration params).
+func unpackObjectClass(typ string, stepsJs map[string]interface{}) map[string]interface{} {
+	if typ == "integration" {
+		// unpack attributes.configuration (integration) which is a string-encoded JSON value
+		confStr, hasConfStr := GetNestedValueOrDefault(stepsJs, ToKeyPath("params"), nil).(string)
+		if hasConfStr {
+			conf := map[string]interface{}{}
+			err := json.Unmarshal([]byte(confStr), &conf)
+			if err == nil {
+				SetNestedValue(stepsJs, ToKeyPath("params_unpack"), conf)
+			}
+		}
+	}
+	return stepsJs
+}
+
+// Fetches the remote object (from "list <type>s"), and its step/class definition where applicable.
+// Served from the provider's cache (see objectCache) when possible.
+func readShorelineObjectRecord(meta interface{}, typ string, name string) (map[string]interface{}, map[string]interface{}, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	client, isClient := meta.(*apiClient)
+	if isClient && client != nil && client.cache != nil {
+		record, stepsJs, found := client.cache.Get(typ, name)
+		if found {
+			return record, unpackObjectClass(typ, stepsJs), nil
+		}
+	}
+
+	op := fmt.Sprintf("list %ss | name = \"%s\"", typ, name)
+	js, err := runOpCommandToJson(op)
+	if err != nil {
+		diags = diag.Errorf("Failed to read %s - %s: %s", typ, name, err.Error())
+		return nil, nil, diags
+	}
+
+	stepsJs := map[string]interface{}{}
+
+	if objectTypeHasClass(typ) {
+		// extract fields from step objects
+		op := fmt.Sprintf("get_%s_class( %s_name = \"%s\" )", typ, typ, name)
+		extraJs, err := runOpCommandToJson(op)
+		if err != nil {
+			diags = diag.Errorf("Failed to read %s - %s: %s", typ, name, err.Error())
+			return nil, nil, diags
+		}
+		stepsJs = unpackObjectClass(typ, getNamedObjectFromClassDef(name, typ, extraJs))
+	}
+
+	record, found := indexObjectRecords(js)[name]
+	if !found {
+		diags = diag.Errorf("Failed to find %s '%s'", typ, name)
+		return nil, nil, diags
+	}
+
+	return record, stepsJs, nil
+}
+
+// Converts a raw backend value to the terraform representation of the attribute type.
+func castAttrValue(attrTyp string, val interface{}) interface{} {
+	switch attrTyp {
+	case "float":
+		return float64(CastToNumber(val))
+	case "int":
+		return CastToInt(val)
+	case "unsigned":
+		return CastToInt(val)
+	case "bool":
+		return CastToBool(val)
+	case "intbool":
+		return CastToBool(val)
+	case "string[]":
+		return CastToArray(val)
+	case "string_set":
+		return CastToArray(val)
+	case "string":
+		return CastToString(val)
+	case "command":
+		return CastToString(val)
+	case "label":
+		return CastToString(val)
+	case "time_s":
+		return CastToString(val) + "s"
+	}
+	return val
+}
+
 func resourceShorelineObjectRead(typ string, attrs map[string]interface{}) func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 		// use the meta value to retrieve your client from the provider configure method
@@ -1631,87 +1973,38 @@ func resourceShorelineObjectRead(typ string, attrs map[string]interface{}) func(
 		}
 		// valid-variable-name check
 		idFromAPI := name
+		registerSensitiveFields(attrs, d)
 		appendActionLog(fmt.Sprintf("Reading %s: '%s' (%v) :: %+v\n", typ, idFromAPI, name, d))
+		attrs, _ := resolveObjectAttrs(typ, attrs, meta)
 
-		op := fmt.Sprintf("list %ss | name = \"%s\"", typ, name)
-		js, err := runOpCommandToJson(op)
-		if err != nil {
-			diags = diag.Errorf("Failed to read %s - %s: %s", typ, name, err.Error())
-			return diags
-		}
-
-		stepsJs := map[string]interface{}{}
-
-		if typ == "alarm" || typ == "action" || typ == "bot" || typ == "integration" || typ == "notebook" {
-			// extract fields from step objects
-			op := fmt.Sprintf("get_%s_class( %s_name = \"%s\" )", typ, typ, name)
-			extraJs, err := runOpCommandToJson(op)
-			if err != nil {
-				diags = diag.Errorf("Failed to read %s - %s: %s", typ, name, err.Error())
-				return diags
-			}
-			stepsJs = getNamedObjectFromClassDef(name, typ, extraJs)
-
-			if typ == "integration" {
-				// unpack attributes.configuration (integration) which is a string-encoded JSON value
-				confStr, hasConfStr := GetNestedValueOrDefault(stepsJs, ToKeyPath("params"), nil).(string)
-				if hasConfStr {
-					conf := map[string]interface{}{}
-					err := json.Unmarshal([]byte(confStr), &conf)
-					if err == nil {
-						SetNestedValue(stepsJs, ToKeyPath("params_unpack"), conf)
-					}
-				}
-			}
-		}
-
-		found := false
-		record := map[string]interface{}{}
-		symbols, isArray := GetNestedValueOrDefault(js, ToKeyPath("list_type.symbol"), []interface{}{}).([]interface{})
-		if isArray {
-			for _, s := range symbols {
-				sName, isStr := GetNestedValueOrDefault(s, ToKeyPath("attributes.name"), "").(string)
-				if isStr && name == sName {
-					record = s.(map[string]interface{})
-					found = true
-				}
-			}
-		}
-
-		if !found {
-			diags = diag.Errorf("Failed to find %s '%s'", typ, name)
+		record, stepsJs, diags := readShorelineObjectRecord(meta, typ, name)
+		if diags != nil {
 			return diags
 		}
 
 		for key, _ := range attrs {
+			if GetNestedValueOrDefault(attrs, ToKeyPath(key+".write_only"), false).(bool) {
+				// never stored in the state
+				d.Set(key, nil)
+				continue
+			}
 			skip, val, diags := resourceShorelineObjectReadSingleAttr(name, typ, key, attrs, record, stepsJs, d)
 			if diags != nil {
 				return diags
 			}
+			if GetNestedValueOrDefault(attrs, ToKeyPath(key+".sensitive"), false).(bool) {
+				registerSensitiveValue(val)
+			}
 			if skip {
 				appendActionLog(fmt.Sprintf("Reading (skip) %s field: '%s'.'%s' :: %+v\n", typ, name, key, val))
 				continue
 			}
 
-			// if there's an obsolete prior name, with a value set, skip
-			replaces := GetNestedValueOrDefault(attrs, ToKeyPath(key+".replaces"), "").(string)
-			if replaces != "" {
-				_, replacesSet := d.GetOk(replaces)
-				if replacesSet {
-					appendActionLog(fmt.Sprintf("Reading deprecated/renamed skipping new (for obsolete) field : %s: '%s'.'%s'->'%s'  '%v'\n", typ, name, key, replaces, val))
-					continue
-				}
+			if other := renamedFieldInUse(key, attrs, d); other != "" {
+				appendActionLog(fmt.Sprintf("Reading deprecated/renamed skipping field (for '%s'): %s: '%s'.'%s'  '%v'\n", other, typ, name, key, val))
+				continue
 			}
 
-			// on failure, if field is deprecated and renamed and set in HCL, try the new name
-			deprecatedFor := GetNestedValueOrDefault(attrs, ToKeyPath(key+".deprecated_for"), "").(string)
-			if deprecatedFor != "" && val == nil {
-				appendActionLog(fmt.Sprintf("Reading deprecated/renamed field : %s: '%s'.'%s'->'%s'  '%v'\n", typ, name, key, deprecatedFor, val))
-				_, isSet := d.GetOk(key)
-				if isSet {
-					_, val, diags = resourceShorelineObjectReadSingleAttr(name, typ, key, attrs, record, stepsJs, d)
-				}
-			}
 			if val == nil {
 				// not found, so check for a default value and assume that
 				defowlt := GetNestedValueOrDefault(attrs, ToKeyPath(key+".default"), nil)
@@ -1735,49 +2028,64 @@ func resourceShorelineObjectRead(typ string, attrs map[string]interface{}) func(
 
 			appendActionLog(fmt.Sprintf("Reading (updating local state) %s field: '%s'.'%s' :: %+v\n", typ, name, key, val))
 			attrTyp := GetNestedValueOrDefault(attrs, ToKeyPath(key+".type"), "string").(string)
-			switch attrTyp {
-			case "float":
-				d.Set(key, float64(CastToNumber(val)))
-			case "int":
-				d.Set(key, CastToInt(val))
-			case "unsigned":
-				d.Set(key, CastToInt(val))
-			case "bool":
-				d.Set(key, CastToBool(val))
-			case "intbool":
-				d.Set(key, CastToBool(val))
-			case "string[]":
-				d.Set(key, CastToArray(val))
-			case "string_set":
-				d.Set(key, CastToArray(val))
-			case "string":
-				d.Set(key, CastToString(val))
-			case "command":
-				d.Set(key, CastToString(val))
-			case "label":
-				d.Set(key, CastToString(val))
-			case "time_s":
-				d.Set(key, CastToString(val)+"s")
-			default:
-				d.Set(key, val)
-			}
+			d.Set(key, castAttrValue(attrTyp, val))
 		}
+		d.Set("extra_attributes", readExtraAttributes(typ, name, record, d))
 		return diags
 	}
 }
 
-func resourceShorelineObjectUpdate(typ string, attrs map[string]interface{}) func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+func resourceShorelineObjectUpdate(typ string, primary string, attrs map[string]interface{}, ready map[string]interface{}, rename map[string]interface{}, referrers []objectReferrer) func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 		// use the meta value to retrieve your client from the provider configure method
 		// client := meta.(*apiClient)
 
 		var diags diag.Diagnostics
 		name := d.Get("name").(string)
+		registerSensitiveFields(attrs, d)
 		appendActionLog(fmt.Sprintf("Updated object '%s': '%s' :: %+v\n", typ, name, d))
 
-		diags = resourceShorelineObjectSetFields(typ, attrs, ctx, d, meta, true, false)
+		diags = checkShorelineObjectReferences(meta, typ, attrs, d, true)
+		if diags != nil {
+			// nothing was written
+			d.Partial(true)
+			return diags
+		}
+
+		if d.HasChange("name") {
+			recreated, renameDiags := renameShorelineObject(ctx, d, meta, typ, primary, attrs, rename, referrers)
+			if renameDiags.HasError() {
+				return renameDiags
+			}
+			if recreated {
+				// all fields were set on the copy
+				diags = append(renameDiags, waitForShorelineObjectReady(ctx, typ, ready, d, d.Timeout(schema.TimeoutUpdate))...)
+				if diags.HasError() {
+					return diags
+				}
+				return append(diags, resourceShorelineObjectRead(typ, attrs)(ctx, d, meta)...)
+			}
+		}
+
+		// snapshot the remote object, so a partial update can be rolled back
+		snapshot, snapDiags := readShorelineObjectSnapshot(meta, typ, name, attrs)
+		if snapDiags != nil {
+			d.Partial(true)
+			return snapDiags
+		}
+
+		written := map[string]bool{}
+		diags = resourceShorelineObjectSetFields(typ, attrs, ctx, d, meta, true, false, written)
+		invalidateCachedObject(meta, typ, name)
+		if diags != nil {
+			diags = append(diags, resourceShorelineObjectRestore(meta, typ, attrs, name, snapshot, written)...)
+			// keep the prior state, which the object was rolled back to
+			d.Partial(true)
+			return diags
+		}
+
+		diags = waitForShorelineObjectReady(ctx, typ, ready, d, d.Timeout(schema.TimeoutUpdate))
 		if diags != nil {
-			// TODO delete incomplete object?
 			return diags
 		}
 
@@ -1786,26 +2094,118 @@ func resourceShorelineObjectUpdate(typ string, attrs map[string]interface{}) fun
 	}
 }
 
-func resourceShorelineObjectDelete(typ string) func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+// Returns the current remote values of an object's attributes (in terraform representation).
+func readShorelineObjectSnapshot(meta interface{}, typ string, name string, attrs map[string]interface{}) (map[string]interface{}, diag.Diagnostics) {
+	attrs, _ = resolveObjectAttrs(typ, attrs, meta)
+	record, stepsJs, diags := readShorelineObjectRecord(meta, typ, name)
+	if diags != nil {
+		return nil, diags
+	}
+	snapshot := map[string]interface{}{}
+	for key, _ := range attrs {
+		skip, val, diags := resourceShorelineObjectReadSingleAttr(name, typ, key, attrs, record, stepsJs, nil)
+		if diags != nil {
+			return nil, diags
+		}
+		if skip {
+			continue
+		}
+		if val == nil {
+			val = GetNestedValueOrDefault(attrs, ToKeyPath(key+".default"), nil)
+			if val == nil {
+				continue
+			}
+		}
+		attrTyp := GetNestedValueOrDefault(attrs, ToKeyPath(key+".type"), "string").(string)
+		snapshot[key] = castAttrValue(attrTyp, val)
+	}
+	appendActionLog(fmt.Sprintf("Snapshot of %s '%s' :: %+v\n", typ, name, snapshot))
+	return snapshot, nil
+}
+
+// Restores the fields written by a failed update to their snapshot values,
+// then the enabled state (as OpLang disables objects on any change).
+// NOTE: computed fields (e.g. uploaded file data) and write-only ones (e.g. credentials) can't be restored.
+func resourceShorelineObjectRestore(meta interface{}, typ string, attrs map[string]interface{}, name string, snapshot map[string]interface{}, written map[string]bool) diag.Diagnostics {
+	var diags diag.Diagnostics
+	attrs, _ = resolveObjectAttrs(typ, attrs, meta)
+
+	keys := []string{}
+	params := []string{}
+	for key, _ := range written {
+		if key == "enabled" || GetNestedValueOrDefault(attrs, ToKeyPath(key+".computed"), false).(bool) {
+			continue
+		}
+		if GetNestedValueOrDefault(attrs, ToKeyPath(key+".write_only"), false).(bool) {
+			// not in the snapshot
+			continue
+		}
+		if GetNestedValueOrDefault(attrs, ToKeyPath(key+".param"), "").(string) != "" {
+			// packed, and restored together below (removing those that weren't set)
+			params = append(params, key)
+			continue
+		}
+		if _, exists := snapshot[key]; exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(params)
+	// notebook "data" overrides other fields, so it has to go first
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == "data" || keys[j] == "data" {
+			return keys[i] == "data"
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		appendActionLog(fmt.Sprintf("Rolling back %s field: '%s'.'%s' :: %+v\n", typ, name, key, snapshot[key]))
+		_, fieldDiags := setFieldInner(key, snapshot[key], name, typ, attrs, nil, nil, nil, false, false, map[string]bool{}, map[string]interface{}{})
+		if fieldDiags != nil {
+			diags = append(diags, diag.Errorf("Failed to roll back %s %s.%s", typ, name, key)...)
+			diags = append(diags, fieldDiags...)
+		}
+	}
+	if len(params) > 0 {
+		invalidateCachedObject(meta, typ, name)
+		paramsDiags := restoreObjectParams(meta, typ, attrs, name, params, snapshot)
+		if paramsDiags != nil {
+			diags = append(diags, diag.Errorf("Failed to roll back %s %s.%s", typ, name, objectParamsField)...)
+			diags = append(diags, paramsDiags...)
+		}
+	}
+
+	enabled, hasEnabled := snapshot["enabled"]
+	if hasEnabled && len(keys)+len(params) > 0 {
+		enableDiags := setObjectEnabled(typ, name, ForceToBool(enabled))
+		if enableDiags != nil {
+			diags = append(diags, diag.Errorf("Failed to roll back enabled state of %s %s", typ, name)...)
+			diags = append(diags, enableDiags...)
+		}
+	}
+
+	if diags == nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Rolled back %s '%s' to its prior state after the failed update.", typ, name),
+		})
+	}
+	return diags
+}
+
+func resourceShorelineObjectDelete(typ string, attrs map[string]interface{}, referrers []objectReferrer) func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 		// use the meta value to retrieve your client from the provider configure method
 		// client := meta.(*apiClient)
 
 		var diags diag.Diagnostics
 		name := d.Get("name").(string)
+		registerSensitiveFields(attrs, d)
 		appendActionLog(fmt.Sprintf("deleting %s: '%s' :: %+v\n", typ, name, d))
+		invalidateCachedObject(meta, typ, name)
 
-		op := fmt.Sprintf("delete %s", name)
-		result, err := runOpCommand(op, true)
-		if err != nil {
-			// TODO check already exists
-			diags = diag.Errorf("Failed to delete %s: %s", typ, err.Error())
-		}
-		err = CheckUpdateResult(result)
-		if err != nil {
-			diags = diag.Errorf("Failed to delete %s: %s", typ, err.Error())
-			return diags
-		}
+		force, _ := d.Get("force_destroy").(bool)
+		diags = deleteShorelineObjectWithRefs(ctx, meta, typ, name, referrers, force, d.Timeout(schema.TimeoutDelete))
 		return diags
 	}
 }
@@ -11,14 +11,14 @@ var ObjectConfigJsonStr = `
 			"name":                    { "type": "label",      "required": true, "forcenew": true, "skip": true },
 			"command":                 { "type": "command",    "required": true, "primary": true, "refs": {"action":1} },
 			"description":             { "type": "string",     "optional": true },
-			"enabled":                 { "type": "intbool",    "optional": true, "default": false },
+			"enabled":                 { "type": "intbool",    "optional": true, "computed": true },
 			"params":                  { "type": "string[]",   "optional": true },
 			"resource_tags_to_export": { "type": "string_set", "optional": true },
 			"res_env_var":             { "type": "string",     "optional": true },
 			"resource_query":          { "type": "command",    "optional": true },
-			"shell":                   { "type": "string",     "optional": true },
-			"timeout":                 { "type": "int",        "optional": true, "default": 60000 },
-			"file_deps":               { "type": "string_set", "optional": true, "refs": {"file":1} },
+			"shell":                   { "type": "string",     "optional": true, "regex": "^/\\S+$", "advisory": true },
+			"timeout":                 { "type": "int",        "optional": true, "default": 60000, "min": 1 },
+			"file_deps":               { "type": "string_set", "optional": true, "refs": {"file":"detach"} },
 			"start_short_template":    { "type": "string",     "optional": true, "step": "start_step_class.short_template" },
 			"start_long_template":     { "type": "string",     "optional": true, "step": "start_step_class.long_template" },
 			"start_title_template":    { "type": "string",     "optional": true, "step": "start_step_class.title_template", "suppress_null_regex": "^started \\w*$" },
@@ -35,15 +35,26 @@ var ObjectConfigJsonStr = `
 		}
 	},
 
+	"action_sequence": {
+		"attributes": {
+			"type":            { "type": "string",   "computed": true, "value": "ACTION_SEQUENCE" },
+			"name":            { "type": "label",    "required": true, "forcenew": true, "skip": true },
+			"steps":           { "type": "string[]", "required": true, "primary": true, "regex": "^[_a-zA-Z][_a-zA-Z0-9]*(\\(.*\\))?$",
+			                     "refs": {"action":"keep"}, "check_refs": true },
+			"description":     { "type": "string",   "optional": true },
+			"stop_on_failure": { "type": "bool",     "optional": true, "default": true }
+		}
+	},
+
 	"alarm": {
 		"attributes": {
 			"type":                   { "type": "string",   "computed": true, "value": "ALARM" },
 			"name":                   { "type": "label",    "required": true, "forcenew": true, "skip": true },
-			"fire_query":             { "type": "command",  "required": true, "primary": true, "refs": {"action":1} },
-			"clear_query":            { "type": "command",  "optional": true, "refs": {"action":1} },
+			"fire_query":             { "type": "command",  "required": true, "primary": true, "refs": {"action":1, "metric":1, "derived_metric":1, "metric_set":1} },
+			"clear_query":            { "type": "command",  "optional": true, "refs": {"action":1, "metric":1, "derived_metric":1, "metric_set":1} },
 			"description":            { "type": "string",   "optional": true },
 			"resource_query":         { "type": "command",  "optional": true },
-			"enabled":                { "type": "intbool",  "optional": true, "default": false },
+			"enabled":                { "type": "intbool",  "optional": true, "computed": true },
 			"mute_query":             { "type": "string",   "optional": true },
 			"resolve_short_template": { "type": "string",   "optional": true, "step": "clear_step_class.short_template" },
 			"resolve_long_template":  { "type": "string",   "optional": true, "step": "clear_step_class.long_template" },
@@ -51,15 +62,17 @@ var ObjectConfigJsonStr = `
 			"fire_short_template":    { "type": "string",   "optional": true, "step": "fire_step_class.short_template" },
 			"fire_long_template":     { "type": "string",   "optional": true, "step": "fire_step_class.long_template" },
 			"fire_title_template":    { "type": "string",   "optional": true, "step": "fire_step_class.title_template", "suppress_null_regex": "^fired \\w*$" },
-			"condition_type":         { "type": "command",  "optional": true, "step": "condition_details.[0].condition_type" },
+			"condition_type":         { "type": "command",  "optional": true, "step": "condition_details.[0].condition_type", "enum": ["above", "below"] },
 			"condition_value":        { "type": "string",   "optional": true, "step": "condition_details.[0].condition_value", "match_null": "0", "outtype": "float" },
-			"metric_name":            { "type": "string",   "optional": true, "step": "condition_details.[0].metric_name" },
-			"raise_for":              { "type": "command",  "optional": true, "step": "condition_details.[0].raise_for", "default": "local" },
-			"check_interval_sec":     { "type": "command",  "optional": true, "step": "check_interval_sec", "default": 1, "outtype": "int" },
+			"metric_name":            { "type": "string",   "optional": true, "step": "condition_details.[0].metric_name",
+			                            "refs": {"metric":1, "derived_metric":1, "metric_set":1} },
+			"raise_for":              { "type": "command",  "optional": true, "step": "condition_details.[0].raise_for", "default": "local", "enum": ["local", "global"] },
+			"check_interval_sec":     { "type": "command",  "optional": true, "step": "check_interval_sec", "default": 1, "outtype": "int", "regex": "^\\s*[0-9]+\\s*$" },
 			"compile_eligible":       { "type": "bool",     "optional": true, "step": "compile_eligible", "default": true },
 			"resource_type":          { "type": "resource", "optional": true, "step": "resource_type" },
-			"family":                 { "type": "command",  "optional": true, "step": "config_data.family", "default": "custom" }
-		}
+			"family":                 { "type": "command",  "optional": true, "step": "config_data.family", "default": "custom", "enum": ["custom", "standard", "metric", "system check"] }
+		},
+		"ready": { "op": "list alarms | name = \"${name}\"", "path": "list_type.symbol.[0].attributes.compiled", "expect": true, "if_attr": "enabled" }
 	},
 
 	"bot": {
@@ -71,18 +84,19 @@ var ObjectConfigJsonStr = `
 				"compound_out": "if ${alarm_statement} then ${action_statement} fi"
 			},
 			"description":             { "type": "string",  "optional": true },
-			"enabled":                 { "type": "intbool", "optional": true, "default": false },
-			"family":                  { "type": "command", "optional": true, "step": "config_data.family", "default": "custom" },
+			"enabled":                 { "type": "intbool", "optional": true, "computed": true },
+			"family":                  { "type": "command", "optional": true, "step": "config_data.family", "default": "custom", "enum": ["custom", "standard", "metric", "system check"] },
 			"action_statement":        { "type": "command", "internal": true },
 			"alarm_statement":         { "type": "command", "internal": true },
-			"event_type":              { "type": "string",  "optional": true, "step": "event_type", "alias": "trigger_source", "match_null": "shoreline" },
-			"monitor_id":              { "type": "string",  "optional": true, "step": "monitor_id", "alias": "external_trigger_id" },
+			"event_type":              { "type": "string",  "optional": true, "step": "event_type", "alias": "trigger_source", "alias_out": ["trigger_source", "event_type"], "match_null": "shoreline", "enum": ["shoreline", "datadog"],
+			                           "versions": { "12.3.0": { "alias_out": ["event_type", "trigger_source"] } } },
+			"monitor_id":              { "type": "string",  "optional": true, "step": "monitor_id", "alias": "external_trigger_id", "alias_out": ["external_trigger_id", "monitor_id"],
+			                           "versions": { "12.3.0": { "alias_out": ["monitor_id", "external_trigger_id"] } } },
 			"alarm_resource_query":    { "type": "command", "optional": true },
-			"#trigger_source":         { "type": "string",  "optional": true, "preferred_alias": "event_type", "step": "trigger_source", "default": "shoreline" },
-			"#external_trigger_id":    { "type": "string",  "optional": true, "preferred_alias": "monitor_id", "step": "external_trigger_id", "default": "" },
 			"communication_workspace": { "type": "string", 	"optional": true, "min_ver": "14.1.0", "step": "communication_workspace"},
 			"communication_channel":   { "type": "string", 	"optional": true, "min_ver": "14.1.0", "step": "communication_channel"}
-		}
+		},
+		"ready": { "op": "list bots | name = \"${name}\"", "path": "list_type.symbol.[0].attributes.active", "expect": true, "if_attr": "enabled" }
 	},
 
 	"circuit_breaker": {
@@ -93,12 +107,12 @@ var ObjectConfigJsonStr = `
 				"compound_in": "^\\s*(?P<resource_query>.+)\\s*\\|\\s*(?P<action_name>[a-zA-Z_][a-zA-Z_]*)\\s*$",
 				"compound_out": "${resource_query} | ${action_name}"
 			},
-			"breaker_type":            { "type": "string",  "optional": true },
-			"hard_limit":              { "type": "int",     "required": true },
-			"soft_limit":              { "type": "int",     "optional": true, "default": -1 },
+			"breaker_type":            { "type": "string",  "optional": true, "enum": ["hard", "soft"] },
+			"hard_limit":              { "type": "int",     "required": true, "min": 1 },
+			"soft_limit":              { "type": "int",     "optional": true, "default": -1, "min": -1 },
 			"duration":                { "type": "time_s",  "required": true },
 			"fail_over":               { "type": "string",  "optional": true },
-			"enabled":                 { "type": "bool",    "optional": true, "default": false },
+			"enabled":                 { "type": "bool",    "optional": true, "computed": true },
 			"action_name":             { "type": "command", "internal": true },
 			"resource_query":          { "type": "command", "internal": true },
 			"communication_workspace": { "type": "string",  "optional": true, "min_ver": "14.1.0", "step": "communication_workspace"},
@@ -110,16 +124,22 @@ var ObjectConfigJsonStr = `
 		"attributes": {
 			"type":             { "type": "string",   "computed": true, "value": "FILE" },
 			"name":             { "type": "label",    "required": true, "forcenew": true, "skip": true },
-			"destination_path": { "type": "string",   "required": true, "primary": true },
+			"destination_path": { "type": "string",   "required": true, "primary": true, "regex": "^/" },
 			"description":      { "type": "string",   "optional": true },
 			"resource_query":   { "type": "string",   "required": true },
-			"enabled":          { "type": "intbool",  "optional": true, "default": false },
-			"input_file":       { "type": "string",   "required": true, "skip": true, "not_stored": true },
+			"enabled":          { "type": "intbool",  "optional": true, "computed": true },
+			"input_file":       { "type": "string",   "optional": true, "skip": true, "not_stored": true, "exactly_one_of": ["input_file", "source_dir", "content", "content_base64"] },
+			"source_dir":       { "type": "string",   "optional": true, "skip": true, "not_stored": true, "exactly_one_of": ["input_file", "source_dir", "content", "content_base64"] },
+			"content":          { "type": "string",   "optional": true, "skip": true, "not_stored": true, "exactly_one_of": ["input_file", "source_dir", "content", "content_base64"] },
+			"content_base64":   { "type": "string",   "optional": true, "skip": true, "not_stored": true, "exactly_one_of": ["input_file", "source_dir", "content", "content_base64"] },
+			"include":          { "type": "string[]", "optional": true, "skip": true, "not_stored": true },
+			"exclude":          { "type": "string[]", "optional": true, "skip": true, "not_stored": true },
 			"file_data":        { "type": "string",   "computed": true, "outtype": "file" },
 			"file_length":      { "type": "int",      "computed": true },
 			"checksum":         { "type": "string",   "computed": true },
 			"md5":              { "type": "string",   "optional": true, "proxy": "file_length,checksum,file_data" }
-		}
+		},
+		"ready": { "op": "file_distribution( file_name = \"${name}\" )", "path": "file_distribution.resources", "item": "checksum", "expect_attr": "checksum", "if_attr": "enabled" }
 	},
 
 	"integration": {
@@ -129,31 +149,65 @@ var ObjectConfigJsonStr = `
 			"service_name":                { "type": "command",  "required": true, "primary": true, "forcenew": true, "skip": true },
 			"serial_number":               { "type": "string",   "required": true },
 			"permissions_user":            { "type": "string",   "optional": true, "match_null": "Shoreline" },
-			"api_key":                     { "type": "string",   "optional": true, "step": "params_unpack.api_key" },
-			"app_key":                     { "type": "string",   "optional": true, "step": "params_unpack.app_key" },
-			"dashboard_name":              { "type": "string",   "optional": true, "step": "params_unpack.dashboard_name" },
-			"webhook_name":                { "type": "string",   "optional": true, "step": "params_unpack.webhook_name" },
+			"api_key":                     { "type": "string",   "optional": true, "param": "api_key", "step": "params_unpack.api_key", "sensitive": true, "write_only": true, "rotate_with": "credentials_version" },
+			"app_key":                     { "type": "string",   "optional": true, "param": "app_key", "step": "params_unpack.app_key", "sensitive": true, "write_only": true, "rotate_with": "credentials_version" },
+			"credentials_version":         { "type": "string",   "optional": true, "skip": true, "not_stored": true },
+			"dashboard_name":              { "type": "string",   "optional": true, "param": "dashboard_name", "step": "params_unpack.dashboard_name" },
+			"webhook_name":                { "type": "string",   "optional": true, "param": "webhook_name", "step": "params_unpack.webhook_name" },
 			"##description":               { "type": "string",   "optional": true },
-			"##account_id":                  { "type": "string",   "optional": true },
-			"##insights_collector_url":      { "type": "string",   "required": true },
-			"##insights_collector_api_key":  { "type": "string",   "required": true },
-			"##incident_management_url":     { "type": "string",   "optional": true },
-			"##incident_management_api_key": { "type": "string",   "optional": true },
-			"enabled":                     { "type": "intbool",  "optional": true, "default": false }
+			"account_id":                  { "type": "string",   "optional": true, "param": "account_id", "step": "params_unpack.account_id" },
+			"insights_collector_url":      { "type": "string",   "optional": true, "param": "insights_collector_url", "step": "params_unpack.insights_collector_url", "regex": "^https://" },
+			"insights_collector_api_key":  { "type": "string",   "optional": true, "param": "insights_collector_api_key", "step": "params_unpack.insights_collector_api_key", "sensitive": true, "write_only": true, "rotate_with": "credentials_version" },
+			"incident_management_url":     { "type": "string",   "optional": true, "param": "incident_management_url", "step": "params_unpack.incident_management_url", "regex": "^https://" },
+			"incident_management_api_key": { "type": "string",   "optional": true, "param": "incident_management_api_key", "step": "params_unpack.incident_management_api_key", "sensitive": true, "write_only": true, "rotate_with": "credentials_version" },
+			"workspace_name":              { "type": "string",   "optional": true, "param": "workspace_name", "step": "params_unpack.workspace_name" },
+			"bot_token":                   { "type": "string",   "optional": true, "param": "bot_token", "step": "params_unpack.bot_token", "sensitive": true, "write_only": true, "rotate_with": "credentials_version" },
+			"signing_secret":              { "type": "string",   "optional": true, "param": "signing_secret", "step": "params_unpack.signing_secret", "sensitive": true, "write_only": true, "rotate_with": "credentials_version" },
+			"routing_key":                 { "type": "string",   "optional": true, "param": "routing_key", "step": "params_unpack.routing_key", "sensitive": true, "write_only": true, "rotate_with": "credentials_version" },
+			"enabled":                     { "type": "intbool",  "optional": true, "computed": true }
+		},
+		"service_attr": "service_name",
+		"services": {
+			"datadog":   { "required": ["api_key", "app_key"], "optional": ["dashboard_name", "webhook_name"] },
+			"newrelic":  { "required": ["account_id", "insights_collector_url", "insights_collector_api_key"], "optional": ["incident_management_url", "incident_management_api_key"] },
+			"slack":     { "required": ["workspace_name", "bot_token"], "optional": ["signing_secret"] },
+			"pagerduty": { "required": ["routing_key"], "optional": ["api_key"] }
 		}
 	},
 
 	"metric": {
 		"attributes": {
 			"type":           { "type": "string",   "computed": true, "value": "METRIC" },
-			"name":           { "type": "label",    "required": true, "forcenew": true, "skip": true },
+			"name":           { "type": "label",    "required": true, "skip": true },
 			"value":          { "type": "command",  "required": true, "primary": true, "alias_out": "val" },
 			"description":    { "type": "string",   "optional": true },
-			"units":          { "type": "string",   "optional": true },
+			"units":          { "type": "string",   "optional": true, "length": [1, 64], "advisory": true },
 			"resource_type":  { "type": "resource", "optional": true }
 		}
 	},
 
+	"derived_metric": {
+		"attributes": {
+			"type":           { "type": "string",     "computed": true, "value": "DERIVED_METRIC" },
+			"name":           { "type": "label",      "required": true, "skip": true },
+			"expression":     { "type": "command",    "required": true, "primary": true },
+			"input_metrics":  { "type": "string_set", "required": true, "refs": {"metric":"keep", "derived_metric":"keep"}, "check_refs": true },
+			"description":    { "type": "string",     "optional": true },
+			"units":          { "type": "string",     "optional": true, "length": [1, 64], "advisory": true },
+			"resource_type":  { "type": "resource",   "optional": true }
+		}
+	},
+
+	"metric_set": {
+		"attributes": {
+			"type":           { "type": "string",     "computed": true, "value": "METRIC_SET" },
+			"name":           { "type": "label",      "required": true, "skip": true },
+			"metrics":        { "type": "string_set", "required": true, "primary": true, "refs": {"metric":"detach", "derived_metric":"detach"}, "check_refs": true },
+			"resource_type":  { "type": "resource",   "required": true },
+			"description":    { "type": "string",     "optional": true }
+		}
+	},
+
 	"notebook": {
 		"attributes": {
 			"type":                    { "type": "string",     "computed": true, "value": "NOTEBOOK" },
@@ -171,7 +225,8 @@ var ObjectConfigJsonStr = `
 			"timeout_ms":              { "type": "unsigned",   "optional": true, "default": 60000 },
 			"allowed_entities":        { "type": "string_set", "optional": true },
 			"approvers":               { "type": "string_set", "optional": true },
-			"resource_query":          { "type": "string",     "optional": true, "deprecated_for": "allowed_resources_query" },
+			"resource_query":          { "type": "string",     "optional": true, "deprecated_for": "allowed_resources_query",
+			                             "versions": { "12.3.0": { "alias_out": "allowed_resources_query", "alias": "allowed_resources_query" } } },
 			"is_run_output_persisted": { "type": "bool",       "optional": true, "step": "is_run_output_persisted", "default": true, "min_ver": "12.3.0" },
 			"allowed_resources_query": { "type": "command",    "optional": true, "replaces": "resource_query", "min_ver": "12.3.0" },
 			"communication_workspace": { "type": "string",     "optional": true, "min_ver": "12.5.0", "step": "communication_workspace"},
@@ -182,7 +237,7 @@ var ObjectConfigJsonStr = `
 	"resource": {
 		"attributes": {
 			"type":            { "type": "string",   "computed": true, "value": "RESOURCE" },
-			"name":            { "type": "label",    "required": true, "forcenew": true, "skip": true },
+			"name":            { "type": "label",    "required": true, "skip": true },
 			"value":           { "type": "command",  "required": true, "primary": true },
 			"description":     { "type": "string",   "optional": true },
 			"params":          { "type": "string[]", "optional": true },
@@ -198,9 +253,9 @@ var ObjectConfigJsonStr = `
 			"type":                  { "type": "string",   "computed": true, "value": "PRINCIPAL" },
 			"name":                  { "type": "label",    "required": true, "forcenew": true, "skip": true },
 			"identity":              { "type": "string",   "required": true, "primary": true },
-			"view_limit":            { "type": "int",      "optional": true },
-			"action_limit":          { "type": "int",      "optional": true },
-			"execute_limit":         { "type": "int",      "optional": true },
+			"view_limit":            { "type": "int",      "optional": true, "min": 0 },
+			"action_limit":          { "type": "int",      "optional": true, "min": 0 },
+			"execute_limit":         { "type": "int",      "optional": true, "min": 0 },
 			"configure_permission":  { "type": "intbool",  "optional": true },
 			"administer_permission": { "type": "intbool",  "optional": true }
 		}
@@ -209,12 +264,15 @@ var ObjectConfigJsonStr = `
 	"docs": {
 		"objects": {
 			"action":    "A command that can be run.\n\nSee the Shoreline [Actions Documentation](https://docs.shoreline.io/actions) for more info.",
+			"action_sequence": "An ordered sequence of Actions, run one after the other.\n\nSee the Shoreline [Action Sequences Documentation](https://docs.shoreline.io/actions/sequences) for more info.",
 			"alarm":     "A condition that triggers Alerts or Actions.\n\nSee the Shoreline [Alarms Documentation](https://docs.shoreline.io/alarms) for more info.",
 			"bot":       "An automation that ties an Action to an Alert.\n\nSee the Shoreline [Bots Documentation](https://docs.shoreline.io/bots) for more info.",
 			"circuit_breaker": "An automatic rate limit on actions.\n\nSee the Shoreline [CircuitBreakers Documentation](https://docs.shoreline.io/circuit_breakers) for more info.",
 			"file":      "A datafile that is automatically copied/distributed to defined Resources.\n\nSee the Shoreline [OpCp Documentation](https://docs.shoreline.io/op/commands/cp) for more info.",
 			"integration":  "A third-party integration (e.g. DataDog, NewRelic, etc) .\n\nSee the Shoreline [Metrics Documentation](https://docs.shoreline.io/integrations) for more info.",
 			"metric":    "A periodic measurement of a system property.\n\nSee the Shoreline [Metrics Documentation](https://docs.shoreline.io/metrics) for more info.",
+			"derived_metric": "A Metric computed from other (input) Metrics by a transformation expression.\n\nSee the Shoreline [Derived Metrics Documentation](https://docs.shoreline.io/configuration/derived-metrics) for more info.",
+			"metric_set": "A named group of Metrics that share a resource type.\n\nSee the Shoreline [Metric Sets Documentation](https://docs.shoreline.io/configuration/metric-sets) for more info.",
 			"notebook":  "An interactive notebook of Op commands and user documentation .\n\nSee the Shoreline [Notebook Documentation](https://docs.shoreline.io/ui/notebooks) for more info.",
 			"principal": "An authorization group (e.g. Okta groups). Note: Admin privilege (in Shoreline) to create principal objects.",
 			"resource":  "A server or compute resource in the system (e.g. host, pod, container).\n\nSee the Shoreline [Resources Documentation](https://docs.shoreline.io/platform/resources) for more info."
@@ -236,17 +294,20 @@ var ObjectConfigJsonStr = `
 			"complete_long_template":  "The long description of the Action's completion.",
 			"complete_short_template": "The short description of the Action's completion.",
 			"complete_title_template": "UI title of the Action's completion.",
+			"content":                 "The inline (UTF-8) data of a distributed File object, e.g. from templatefile() (one of input_file, source_dir, content or content_base64). Its checksum and length are computed, so changes are detected without an md5.",
+			"content_base64":          "The inline data of a distributed File object, base64 encoded, e.g. from filebase64() for binary data (one of input_file, source_dir, content or content_base64). Its checksum and length are computed, so changes are detected without an md5.",
 			"condition_type":          "Kind of check in an Alarm (e.g. above or below) vs a threshold for a Metric.",
 			"condition_value":         "Switching value (threshold) for a Metric in an Alarm.",
 			"configure_permission":    "If a permissions group is allowed to perform \"configure\" actions.",
 			"data":                    "The downloaded (JSON) representation of a Notebook.",
 			"description":             "A user-friendly explanation of an object.",
 			"destination_path":        "Target location for a copied distributed File object.  See [Op: cp](https://docs.shoreline.io/op/commands/cp).",
-			"enabled":                 "If the object is currently enabled or disabled.",
+			"enabled":                 "If the object is currently enabled or disabled. When unset, the current state is kept (e.g. as set by a shoreline_enablement), and new objects start disabled.",
 			"error_long_template":     "The long description of the Action's error condition.",
 			"error_short_template":    "The short description of the Action's error condition.",
 			"error_title_template":    "UI title of the Action's error condition.",
 			"event_type":              "Used to tag 'datadog' monitor triggers vs 'shoreline' alarms (default).",
+			"expression":              "The Op expression that computes a Derived Metric from its input Metrics.",
 			"execute_limit":           "The number of simultaneous linux (shell) commands allowed for a permissions group.",
 			"family":                  "General class for an Action or Bot (e.g., custom, standard, metric, or system check).",
 			"file_data":               "Internal representation of a distributed File object's data (computed).",
@@ -257,10 +318,15 @@ var ObjectConfigJsonStr = `
 			"fire_short_template":     "The short description of the Alarm's triggering condition.",
 			"fire_title_template":     "UI title of the Alarm's triggering condition.",
 			"identity":                "The email address or provider's (e.g. Okta) group-name for a permissions group.",
-			"input_file":              "The local source of a distributed File object.",
+			"input_file":              "The local source of a distributed File object (one of input_file, source_dir, content or content_base64).",
+			"include":                 "Globs of the files of a source_dir to pack (all, if empty). Globs without a '/' match file names at any depth, e.g. *.jar.",
+			"exclude":                 "Globs of the files (or directories) of a source_dir to leave out. Globs without a '/' match names at any depth, e.g. *.log.",
+			"source_dir":              "A local directory packed (as a tarball) into a distributed File object, which is copied as is to destination_path, to be extracted e.g. by an action (one of input_file, source_dir, content or content_base64). Its checksum is computed from the packed files, so changes are detected without an md5.",
 			"is_run_output_persisted":  "A boolean value denoting whether or not cell outputs should be persisted when running a notebook",
 			"md5":                     "The md5 checksum of a file, e.g. filemd5(\"${path.module}/data/example-file.txt\")",
-			"metric_name":             "The Alarm's triggering Metric.",
+			"input_metrics":           "The Metrics (or Derived Metrics) that a Derived Metric is computed from.",
+			"metric_name":             "The Alarm's triggering Metric (or Derived Metric, or Metric Set).",
+			"metrics":                 "The Metrics (or Derived Metrics) in a Metric Set.",
 			"monitor_id":              "For 'datadog' monitor triggered bots, the DD monitor identifier.",
 			"mute_query":              "The Alarm's mute condition.",
 			"params":                  "Named variables to pass to an object (e.g. an Action).",
@@ -271,6 +337,8 @@ var ObjectConfigJsonStr = `
 			"resolve_title_template":  "UI title of the Alarm's' resolution.",
 			"resource_query":          "A set of Resources (e.g. host, pod, container), optionally filtered on tags or dynamic conditions.",
 			"shell":                   "The commandline shell to use (e.g. /bin/sh).",
+			"steps":                   "The ordered steps of an Action Sequence, each an Action name, optionally with parameter bindings (e.g. restart_pod(grace_period=\"30\")).",
+			"stop_on_failure":         "If an Action Sequence stops at the first failed step (the default), or runs the remaining steps regardless.",
 			"start_long_template":     "The long description when starting the Action.",
 			"start_short_template":    "The short description when starting the Action.",
 			"start_title_template":    "UI title of the start of the Action.",
@@ -281,9 +349,19 @@ var ObjectConfigJsonStr = `
 			"is_run_output_persisted": "A boolean value denoting whether or not cell outputs should be persisted when running a notebook",
 			"communication_workspace": "A string value denoting the slack workspace where notifications related to the object should be sent to.",
 			"communication_channel":   "A string value denoting the slack channel where notifications related to the object should be sent to.",
-			"service_name":            "The name of a 3rd-party service to integrate with (e.g. 'datadog', or 'newrelic').",
-			"api_key":                 "API key for a 3rd-party service integration.",
-			"app_key":                 "Application key for a 3rd-party service integration.",
+			"service_name":            "The name of a 3rd-party service to integrate with: 'datadog', 'newrelic', 'slack' or 'pagerduty'. Each service requires its own params (checked at plan time).",
+			"api_key":                 "API key for a 3rd-party service integration (datadog, or optionally pagerduty).",
+			"app_key":                 "Application key for a 3rd-party service integration (datadog).",
+			"account_id":              "The account identifier for a 3rd-party service integration (newrelic).",
+			"insights_collector_url":  "The Insights collector (event API) URL for a 3rd-party service integration (newrelic).",
+			"insights_collector_api_key":  "The Insights collector (insert) API key for a 3rd-party service integration (newrelic).",
+			"incident_management_url":     "The incident management (alerts) URL for a 3rd-party service integration (newrelic).",
+			"incident_management_api_key": "The incident management API key for a 3rd-party service integration (newrelic).",
+			"workspace_name":          "The workspace name for a 3rd-party service integration (slack), as used by communication_workspace.",
+			"bot_token":               "The bot (OAuth) token for a 3rd-party service integration (slack).",
+			"signing_secret":          "The request signing secret for a 3rd-party service integration (slack).",
+			"routing_key":             "The Events API routing (integration) key for a 3rd-party service integration (pagerduty).",
+			"credentials_version":     "An arbitrary version for the write-only credentials (e.g. api_key, app_key). They are only sent when the object is created, or when this changes.",
 			"permissions_user":        "The user which 3rd-party service integration remediations run as (default 'Shoreline').",
 			"dashboard_name":          "The name of a dashboard for 3rd-party service integration (datadog).",
 			"webhook_name":            "The name of a webhook for 3rd-party service integration (datadog)."
@@ -5,19 +5,32 @@ package provider
 
 import (
 	//"regexp"
+	"archive/tar"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	//"github.com/hashicorp/terraform-plugin-sdk/acctest"
 	//"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"math/rand"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	zstd "github.com/klauspost/compress/zstd"
 )
 
 func getProviderConfigString() string {
@@ -620,3 +633,1504 @@ func TestCanonicalizeUrl(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveAttrsForVersion(t *testing.T) {
+	attrs := map[string]interface{}{
+		"plain":   map[string]interface{}{"type": "string"},
+		"newer":   map[string]interface{}{"type": "string", "min_ver": "12.3.0"},
+		"renamed": map[string]interface{}{"type": "string", "versions": map[string]interface{}{"12.3.0": map[string]interface{}{"alias_out": "renamed_v12"}, "14.1.0": map[string]interface{}{"alias_out": "renamed_v14"}}},
+	}
+	testCases := []struct {
+		version     string
+		unavailable bool
+		aliasOut    []string
+	}{
+		{version: "release-12.2.9", unavailable: true, aliasOut: []string{"renamed"}},
+		{version: "release-12.3.0", unavailable: false, aliasOut: []string{"renamed_v12"}},
+		{version: "release-14.2.0", unavailable: false, aliasOut: []string{"renamed_v14"}},
+		{version: "unknown", unavailable: false, aliasOut: []string{"renamed_v14"}},
+	}
+
+	for _, testCase := range testCases {
+		resolved := ResolveAttrsForVersion(attrs, ParseVersionString(testCase.version))
+		unavailable := GetNestedValueOrDefault(resolved, ToKeyPath("newer.unavailable"), false).(bool)
+		if unavailable != testCase.unavailable {
+			t.Fatalf("test case %s: unavailable is %v, expected %v\n", testCase.version, unavailable, testCase.unavailable)
+		}
+		aliasOut := attrOutNames(resolved, "renamed")
+		if !reflect.DeepEqual(aliasOut, testCase.aliasOut) {
+			t.Fatalf("test case %s: alias_out is %v, expected %v\n", testCase.version, aliasOut, testCase.aliasOut)
+		}
+		if GetNestedValueOrDefault(resolved, ToKeyPath("plain.unavailable"), false).(bool) {
+			t.Fatalf("test case %s: plain attribute should always be available\n", testCase.version)
+		}
+	}
+
+	// the deprecated notebook resource_query is written as allowed_resources_query where that exists
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	notebook := GetNestedValueOrDefault(objects, ToKeyPath("notebook.attributes"), nil).(map[string]interface{})
+	for version, expected := range map[string]string{"release-12.2.0": "resource_query", "release-12.3.0": "allowed_resources_query"} {
+		resolved := ResolveAttrsForVersion(notebook, ParseVersionString(version))
+		if aliasOut := attrOutNames(resolved, "resource_query"); !reflect.DeepEqual(aliasOut, []string{expected}) {
+			t.Fatalf("notebook resource_query on %s is written as %v, expected %s\n", version, aliasOut, expected)
+		}
+	}
+	// bots write event_type under its old name on older backends, and (as for an unknown version) the new one on newer ones
+	bot := GetNestedValueOrDefault(objects, ToKeyPath("bot.attributes"), nil).(map[string]interface{})
+	for version, expected := range map[string]string{"release-12.2.0": "trigger_source", "release-12.3.0": "event_type", "unknown": "event_type"} {
+		resolved := ResolveAttrsForVersion(bot, ParseVersionString(version))
+		if aliasOut := attrOutNames(resolved, "event_type"); aliasOut[0] != expected {
+			t.Fatalf("bot event_type on %s is written as %v, expected %s first\n", version, aliasOut, expected)
+		}
+	}
+	// the other name is only tried if the backend doesn't know the first one
+	resolved := ResolveAttrsForVersion(bot, ParseVersionString("release-12.3.0"))
+	for backendErr, expected := range map[string][]string{
+		"field does not exist": {"b1.event_type", "b1.trigger_source"},
+		"invalid value":        {"b1.event_type"},
+	} {
+		tried := []string{}
+		fakeOpBackend(t, func(statement string) string {
+			tried = append(tried, strings.SplitN(statement, " = ", 2)[0])
+			return `{"update_bot": {"error": {"message": "` + backendErr + `"}}}`
+		})
+		if diags := setFieldViaOp("bot", resolved, "b1", "event_type", "datadog"); !diags.HasError() {
+			t.Fatalf("expected an error for '%s'\n", backendErr)
+		}
+		if !reflect.DeepEqual(tried, expected) {
+			t.Fatalf("with error '%s', expected %v to be tried, got: %v\n", backendErr, expected, tried)
+		}
+	}
+
+	// and only the name in use is read and written
+	nbSchema := resourceShorelineObject(ObjectConfigJsonStr, "notebook").Schema
+	for _, inUse := range []string{"resource_query", "allowed_resources_query"} {
+		d := schema.TestResourceDataRaw(t, nbSchema, map[string]interface{}{"name": "nb", inUse: "host"})
+		for key, expected := range map[string]string{"resource_query": "allowed_resources_query", "allowed_resources_query": "resource_query"} {
+			if key == inUse {
+				expected = ""
+			}
+			if other := renamedFieldInUse(key, notebook, d); other != expected {
+				t.Fatalf("with %s set, %s is shadowed by '%s', expected '%s'\n", inUse, key, other, expected)
+			}
+		}
+	}
+}
+
+func TestValidateObjectConfig(t *testing.T) {
+	if err := ValidateObjectConfig(ObjectConfigJsonStr, embeddedObjectTypes()); err != nil {
+		t.Fatalf("embedded object definitions are invalid: %s\n", err.Error())
+	}
+
+	testCases := []struct {
+		config    string
+		shouldErr bool
+	}{
+		{
+			config:    `{ "metric": { "attributes": { "name": { "type": "label", "required": true }, "units": { "type": "string", "optional": true, "min_ver": "14.1.0" } } } }`,
+			shouldErr: false,
+		},
+		{
+			config:    `{ "action": { "attributes": { "name": { "type": "label", "required": true } } } }`,
+			shouldErr: true, // missing required type
+		},
+		{
+			config:    `{ "metric": { "attributes": { "units": { "type": "string" } } } }`,
+			shouldErr: true, // missing name
+		},
+		{
+			config:    `{ "metric": { "attributes": { "name": { "type": "label", "requird": true } } } }`,
+			shouldErr: true, // unknown metadata
+		},
+		{
+			config:    `{ "metric": { "attributes": { "name": { "type": "label", "optional": "yes" } } } }`,
+			shouldErr: true, // wrong kind
+		},
+		{
+			config:    `{ "metric": { "attributes": { "name": { "type": "labels" } } } }`,
+			shouldErr: true, // unknown type
+		},
+		{
+			config:    `{ "metric": { "attributes": { "name": { "type": "label", "min_ver": "latest" } } } }`,
+			shouldErr: true, // bad version
+		},
+	}
+
+	for i, testCase := range testCases {
+		err := ValidateObjectConfig(testCase.config, []string{"metric"})
+		if (err != nil) != testCase.shouldErr {
+			t.Fatalf("test case %d: err: %v, expected error: %v\n", i, err, testCase.shouldErr)
+		}
+	}
+}
+
+func TestRefreshObjectConfigCache(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "definitions")
+	defer os.RemoveAll(dir)
+	os.Setenv("SHORELINE_REMOTE_DEFINITIONS", "true")
+	defer os.Unsetenv("SHORELINE_REMOTE_DEFINITIONS")
+	os.Setenv("SHORELINE_DEFINITIONS_CACHE", filepath.Join(dir, "definitions.json"))
+	defer os.Unsetenv("SHORELINE_DEFINITIONS_CACHE")
+
+	remote := ObjectConfigJsonStr
+	fetched := 0
+	fakeOpBackend(t, func(statement string) string {
+		fetched += 1
+		if statement != remoteObjectConfigOp {
+			return `{"error": {"message": "unknown op"}}`
+		}
+		js, _ := json.Marshal(map[string]interface{}{"get_" + remoteObjectConfigOp: remote})
+		return string(js)
+	})
+	url, token := GlobalOpts.Url, GlobalOpts.Token
+	oldVer := ParseVersionString("release-14.1.0")
+	newVer := ParseVersionString("release-" + opMinVersions[remoteObjectConfigOp])
+	oldBackend, meta := &apiClient{backendVersion: &oldVer}, &apiClient{backendVersion: &newVer}
+
+	// backends without the op aren't asked
+	diags := refreshObjectConfigCache(ObjectConfigJsonStr, oldBackend)
+	if len(diags) != 1 || diags[0].Severity != diag.Warning || !strings.Contains(diags[0].Detail, "not supported") || fetched != 0 {
+		t.Fatalf("expected a 'not supported' warning without asking the backend, got: %v\n", diags)
+	}
+
+	// without a cache, the embedded definitions are used, and the backend's are cached for the next run
+	if LoadObjectConfig() != ObjectConfigJsonStr {
+		t.Fatalf("expected the embedded definitions without a cache\n")
+	}
+	diags = refreshObjectConfigCache(ObjectConfigJsonStr, meta)
+	if len(diags) != 1 || diags[0].Severity != diag.Warning || !strings.Contains(diags[0].Summary, "next run") {
+		t.Fatalf("expected a warning that the definitions changed, got: %v\n", diags)
+	}
+	cached := LoadObjectConfig()
+	if cached == ObjectConfigJsonStr || ValidateObjectConfig(cached, embeddedObjectTypes()) != nil {
+		t.Fatalf("expected valid cached definitions\n")
+	}
+	if diags := refreshObjectConfigCache(cached, meta); diags != nil {
+		t.Fatalf("expected no warnings for unchanged definitions, got: %v\n", diags)
+	}
+
+	// invalid definitions only warn, and keep the cache
+	remote = `{"action": {}}`
+	diags = refreshObjectConfigCache(cached, meta)
+	if len(diags) != 1 || diags[0].Severity != diag.Warning || LoadObjectConfig() != cached {
+		t.Fatalf("expected a warning and the cache to be kept, got: %v\n", diags)
+	}
+	if GlobalOpts.Url != url || GlobalOpts.Token != token {
+		t.Fatalf("expected the auth options to be left as configured\n")
+	}
+}
+
+func TestEnablementObjectTypes(t *testing.T) {
+	types := enablementObjectTypes(ObjectConfigJsonStr)
+	if !reflect.DeepEqual(types, []string{"action", "alarm", "bot", "circuit_breaker", "file", "integration"}) {
+		t.Fatalf("unexpected enablement object types: %v\n", types)
+	}
+	// unset, the definition keeps the state that shoreline_enablement sets
+	for _, typ := range types {
+		enabled := resourceShorelineObject(ObjectConfigJsonStr, typ).Schema["enabled"]
+		if !enabled.Optional || !enabled.Computed || enabled.Default != nil {
+			t.Fatalf("%s: expected 'enabled' to be optional and computed, without a default\n", typ)
+		}
+	}
+}
+
+func TestEvalReadyCheck(t *testing.T) {
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	// the embedded checks: of a list of items (file), and of a single value (bot)
+	listCheck := GetNestedValueOrDefault(objects, ToKeyPath("file.ready"), nil).(map[string]interface{})
+	valueCheck := GetNestedValueOrDefault(objects, ToKeyPath("bot.ready"), nil).(map[string]interface{})
+	for _, typ := range []string{"alarm", "bot", "file"} {
+		attrs := GetNestedValueOrDefault(objects, ToKeyPath(typ+".attributes"), nil).(map[string]interface{})
+		if err := validateReadyCheck(typ, GetNestedValueOrDefault(objects, ToKeyPath(typ+".ready"), nil), attrs); err != nil {
+			t.Fatalf("invalid %s ready check: %s\n", typ, err.Error())
+		}
+	}
+
+	op := readyCheckOp(listCheck, func(key string) interface{} { return map[string]interface{}{"name": "jvm_scripts"}[key] })
+	if op != "file_distribution( file_name = \"jvm_scripts\" )" {
+		t.Fatalf("unexpected ready check op: %s\n", op)
+	}
+
+	testCases := []struct {
+		check    map[string]interface{}
+		result   string
+		expect   interface{}
+		expected bool
+	}{
+		{check: listCheck, result: `{"file_distribution": {"resources": [{"checksum": "abc"}, {"checksum": "abc"}]}}`, expect: "abc", expected: true},
+		{check: listCheck, result: `{"file_distribution": {"resources": [{"checksum": "abc"}, {"checksum": "old"}]}}`, expect: "abc", expected: false},
+		{check: listCheck, result: `{"file_distribution": {"resources": []}}`, expect: "abc", expected: false},
+		{check: listCheck, result: `{}`, expect: "abc", expected: false},
+		{check: valueCheck, result: `{"list_type": {"symbol": [{"attributes": {"active": true}}]}}`, expect: true, expected: true},
+		{check: valueCheck, result: `{"list_type": {"symbol": [{"attributes": {"active": 1}}]}}`, expect: true, expected: true},
+		{check: valueCheck, result: `{"list_type": {"symbol": [{"attributes": {"active": false}}]}}`, expect: true, expected: false},
+		{check: valueCheck, result: `{"list_type": {"symbol": []}}`, expect: true, expected: false},
+	}
+
+	for i, testCase := range testCases {
+		result, _ := StringToJson(testCase.result)
+		ready, pending := EvalReadyCheck(testCase.check, result, testCase.expect)
+		if ready != testCase.expected {
+			t.Fatalf("test case %d: ready is %v (%s), expected %v\n", i, ready, pending, testCase.expected)
+		}
+	}
+}
+
+func TestWriteOnlyFields(t *testing.T) {
+	res := resourceShorelineObject(ObjectConfigJsonStr, "integration")
+	apiKey := res.Schema["api_key"]
+	if !apiKey.Sensitive {
+		t.Fatalf("integration api_key should be sensitive\n")
+	}
+
+	testCases := []struct {
+		raw      map[string]interface{}
+		id       string
+		suppress bool
+	}{
+		{raw: map[string]interface{}{"name": "dd", "api_key": "secret"}, id: "", suppress: false},
+		{raw: map[string]interface{}{"name": "dd", "api_key": "secret"}, id: "dd", suppress: true},
+		{raw: map[string]interface{}{"name": "dd", "api_key": "secret", "credentials_version": "2"}, id: "dd", suppress: false},
+	}
+	for i, testCase := range testCases {
+		d := schema.TestResourceDataRaw(t, res.Schema, testCase.raw)
+		d.SetId(testCase.id)
+		suppress := apiKey.DiffSuppressFunc("api_key", "", "secret", d)
+		if suppress != testCase.suppress {
+			t.Fatalf("test case %d: suppress is %v, expected %v\n", i, suppress, testCase.suppress)
+		}
+	}
+
+	registerSensitiveValue("s3cr3t_k3y")
+	msg := redactSensitiveValues("Running OpLang command: dd.api_key = \"s3cr3t_k3y\"")
+	if strings.Contains(msg, "s3cr3t_k3y") {
+		t.Fatalf("sensitive value was not redacted: %s\n", msg)
+	}
+	// short values are only redacted where they're assigned
+	registerSensitiveValue("on")
+	msg = redactSensitiveValues("Running OpLang command: dd.api_key = \"on\" on host")
+	if msg != "Running OpLang command: dd.api_key = \"<sensitive>\" on host" {
+		t.Fatalf("unexpected redaction of a short value: %s\n", msg)
+	}
+	msg = redactSensitiveValues("Setting integration field: 'dd'.'api_key' :: on")
+	if msg != "Setting integration field: 'dd'.'api_key' :: <sensitive>" {
+		t.Fatalf("unexpected redaction of a short value: %s\n", msg)
+	}
+}
+
+func TestAttrMetaValidateFunc(t *testing.T) {
+	testCases := []struct {
+		rules      string
+		val        interface{}
+		shouldErr  bool
+		shouldWarn bool
+	}{
+		{rules: `{ "enum": ["above", "below"] }`, val: "above", shouldErr: false},
+		{rules: `{ "enum": ["above", "below"] }`, val: "sideways", shouldErr: false, shouldWarn: true},
+		{rules: `{ "regex": "^/\\S+$" }`, val: "/bin/bash", shouldErr: false},
+		{rules: `{ "regex": "^/\\S+$" }`, val: "bash", shouldErr: true},
+		{rules: `{ "min": 1 }`, val: 1, shouldErr: false},
+		{rules: `{ "min": 1 }`, val: 0, shouldErr: true},
+		{rules: `{ "min": -1, "max": 10 }`, val: 11, shouldErr: true},
+		{rules: `{ "length": [1, 5] }`, val: "cores", shouldErr: false},
+		{rules: `{ "length": [1, 5] }`, val: "percent", shouldErr: true},
+		{rules: `{ "enum": ["hard"], "length": [1, 3] }`, val: "soft", shouldErr: true, shouldWarn: true},
+		{rules: `{ "regex": "^/\\S+$", "advisory": true }`, val: "bash", shouldErr: false, shouldWarn: true},
+		{rules: `{ "regex": "^/\\S+$", "advisory": true }`, val: "/bin/sh", shouldErr: false, shouldWarn: false},
+		{rules: `{ "length": [1, 5], "advisory": true }`, val: "percent", shouldErr: false, shouldWarn: true},
+	}
+
+	for i, testCase := range testCases {
+		rules, _ := StringToJson(testCase.rules)
+		validate := attrMetaValidateFunc(rules)
+		if validate == nil {
+			t.Fatalf("test case %d: no validator for rules %s\n", i, testCase.rules)
+		}
+		warns, errs := validate(testCase.val, "field")
+		if (len(errs) > 0) != testCase.shouldErr {
+			t.Fatalf("test case %d: errors: %v, expected error: %v\n", i, errs, testCase.shouldErr)
+		}
+		if (len(warns) > 0) != testCase.shouldWarn {
+			t.Fatalf("test case %d: warnings: %v, expected warning: %v\n", i, warns, testCase.shouldWarn)
+		}
+	}
+
+	if attrMetaValidateFunc(map[string]interface{}{"type": "string"}) != nil {
+		t.Fatalf("expected no validator without rules\n")
+	}
+
+	alarm := resourceShorelineObject(ObjectConfigJsonStr, "alarm")
+	warns, errs := alarm.Schema["condition_type"].ValidateFunc("sideways", "condition_type")
+	if len(errs) != 0 || len(warns) == 0 {
+		t.Fatalf("expected alarm condition_type to warn about 'sideways', got: %v, %v\n", warns, errs)
+	}
+	_, errs = alarm.Schema["resource_type"].ValidateFunc("NODE", "resource_type")
+	if len(errs) == 0 {
+		t.Fatalf("expected alarm resource_type to reject 'NODE'\n")
+	}
+	// conventions the backend doesn't enforce only warn
+	action := resourceShorelineObject(ObjectConfigJsonStr, "action")
+	warns, errs = action.Schema["shell"].ValidateFunc("bash", "shell")
+	if len(errs) != 0 || len(warns) == 0 {
+		t.Fatalf("expected action shell to warn about 'bash', got: %v, %v\n", warns, errs)
+	}
+	metric := resourceShorelineObject(ObjectConfigJsonStr, "metric")
+	warns, errs = metric.Schema["units"].ValidateFunc(strings.Repeat("u", 65), "units")
+	if len(errs) != 0 || len(warns) == 0 {
+		t.Fatalf("expected metric units to warn about its length, got: %v, %v\n", warns, errs)
+	}
+}
+
+func TestObjectCache(t *testing.T) {
+	listJs, _ := StringToJson(`{"list_type": {"symbol": [{"attributes": {"name": "a1", "enabled": true}}, {"attributes": {"name": "a2"}}]}}`)
+	classJs, _ := StringToJson(`{"get_alarm_class": {"alarm_classes": [{"name": "a1", "resource_type": "HOST"}]}}`)
+
+	cache := newObjectCache()
+	entry := &objectCacheEntry{done: make(chan struct{}), records: indexObjectRecords(listJs), classes: indexObjectClasses("alarm", classJs)}
+	close(entry.done)
+	cache.types["alarm"] = entry
+
+	record, class, found := cache.Get("alarm", "a1")
+	if !found || GetNestedValueOrDefault(class, ToKeyPath("resource_type"), "") != "HOST" {
+		t.Fatalf("expected cached alarm a1 with its class, got: %v, %v\n", record, class)
+	}
+	// callers may modify what they get
+	SetNestedValue(record, ToKeyPath("attributes.enabled"), false)
+	record, _, _ = cache.Get("alarm", "a1")
+	if GetNestedValueOrDefault(record, ToKeyPath("attributes.enabled"), nil) != true {
+		t.Fatalf("cached record was modified by a caller\n")
+	}
+
+	if _, _, found := cache.Get("alarm", "a2"); found {
+		t.Fatalf("expected a miss for alarm a2 without a class\n")
+	}
+	if _, _, found := cache.Get("alarm", "a3"); found {
+		t.Fatalf("expected a miss for unknown alarm a3\n")
+	}
+	cache.Invalidate("alarm", "a1")
+	if _, _, found := cache.Get("alarm", "a1"); found {
+		t.Fatalf("expected a miss for invalidated alarm a1\n")
+	}
+}
+
+func TestReferencesObject(t *testing.T) {
+	testCases := []struct {
+		val    interface{}
+		name   string
+		result bool
+	}{
+		{`hosts | limit=1 | my_action`, "my_action", true},
+		{`my_action(x=1)`, "my_action", true},
+		{`hosts | my_action_2`, "my_action", false},
+		{`hosts | not_my_action`, "my_action", false},
+		{`cpu_alarm`, "my_action", false},
+		{[]interface{}{"f1", "my_file"}, "my_file", true},
+		{[]interface{}{"f1", "my_file_2"}, "my_file", false},
+		{[]interface{}{"check", `my_action(x="1")`}, "my_action", true},
+		{nil, "my_action", false},
+	}
+
+	for i, testCase := range testCases {
+		result := ReferencesObject(testCase.val, testCase.name)
+		if result != testCase.result {
+			t.Fatalf("test case %d: %v references '%s': %v, expected: %v\n", i, testCase.val, testCase.name, result, testCase.result)
+		}
+	}
+
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	policies := map[string]string{}
+	for _, r := range objectReferrerTypes(objects, "action") {
+		policies[r.typ+"."+r.key] = r.policy
+	}
+	expected := map[string]string{
+		"action.command":          "disable",
+		"alarm.fire_query":        "disable",
+		"alarm.clear_query":       "disable",
+		"bot.command":             "disable",
+		"circuit_breaker.command": "disable",
+		"action_sequence.steps":   "keep",
+	}
+	for key, policy := range expected {
+		if policies[key] != policy {
+			t.Fatalf("expected %s to reference actions with policy '%s', got: %v\n", key, policy, policies)
+		}
+	}
+	if policies := objectReferrerTypes(objects, "file"); len(policies) != 1 || policies[0].policy != "detach" {
+		t.Fatalf("expected action.file_deps to reference files with policy 'detach', got: %v\n", policies)
+	}
+
+	// referrers that are kept, or can't be disabled, are left as is and reported
+	seqAttrs := GetNestedValueOrDefault(objects, ToKeyPath("action_sequence.attributes"), nil).(map[string]interface{})
+	refs := []objectReference{
+		{objectReferrer: objectReferrer{typ: "action_sequence", key: "steps", policy: "keep", attrs: seqAttrs}, name: "seq1"},
+		{objectReferrer: objectReferrer{typ: "action_sequence", key: "steps", policy: "disable", attrs: seqAttrs}, name: "seq2"},
+	}
+	unhandled, diags := detachShorelineObjectReferences(nil, "my_action", refs)
+	if diags != nil || describeObjectReferences(unhandled) != "action_sequence 'seq2', action_sequence 'seq1'" {
+		t.Fatalf("expected both sequences to be reported, got: %v %v\n", unhandled, diags)
+	}
+}
+
+func TestRenameObject(t *testing.T) {
+	testCases := []struct {
+		val    interface{}
+		result interface{}
+	}{
+		{`hosts | limit=1 | old_action`, `hosts | limit=1 | new_action`},
+		{`old_action(x=1) | old_action`, `new_action(x=1) | new_action`},
+		{`hosts | old_action_2 | not_old_action`, `hosts | old_action_2 | not_old_action`},
+		{[]interface{}{"f1", "old_action"}, []interface{}{"f1", "new_action"}},
+		{[]interface{}{"f1", "old_action_2"}, []interface{}{"f1", "old_action_2"}},
+		{[]interface{}{`old_action(x="old_action")`}, []interface{}{`new_action(x="old_action")`}},
+	}
+
+	for i, testCase := range testCases {
+		result := ReplaceObjectReference(testCase.val, "old_action", "new_action")
+		if !reflect.DeepEqual(result, testCase.result) {
+			t.Fatalf("test case %d: renamed references in %v to: %v, expected: %v\n", i, testCase.val, result, testCase.result)
+		}
+	}
+
+	rename := map[string]interface{}{"op": "rename ${old} to ${new}", "min_ver": "14.1.0"}
+	opCases := []struct {
+		version string
+		op      string
+	}{
+		{"release-14.0.9", ""},
+		{"release-14.1.0", "rename a to b"},
+		{"unknown", "rename a to b"},
+	}
+	for i, opCase := range opCases {
+		op := renameOpForVersion(rename, ParseVersionString(opCase.version), "a", "b")
+		if op != opCase.op {
+			t.Fatalf("op case %d: rename op for %s: '%s', expected: '%s'\n", i, opCase.version, op, opCase.op)
+		}
+	}
+	if op := renameOpForVersion(nil, ParseVersionString("unknown"), "a", "b"); op != "" {
+		t.Fatalf("expected copy-then-swap without a rename op, got: '%s'\n", op)
+	}
+
+	if validateRenameOp("action", map[string]interface{}{"op": "rename ${old}"}) == nil {
+		t.Fatalf("expected a rename op without ${new} to be invalid\n")
+	}
+	if err := validateRenameOp("action", rename); err != nil {
+		t.Fatalf("expected a valid rename op, got: %s\n", err.Error())
+	}
+
+	// objects with history are replaced on a change of name, definitions are copied
+	action := resourceShorelineObject(ObjectConfigJsonStr, "action")
+	metric := resourceShorelineObject(ObjectConfigJsonStr, "metric")
+	if _, hasNote := action.Schema["rename_note"]; hasNote || !action.Schema["name"].ForceNew {
+		t.Fatalf("expected a change of action name to replace it\n")
+	}
+	if _, hasNote := metric.Schema["rename_note"]; !hasNote || metric.Schema["name"].ForceNew {
+		t.Fatalf("expected a change of metric name to rename it\n")
+	}
+
+	// unless the backend can rename them in place
+	config := `{ "action": { "attributes": {
+		"name":    { "type": "label", "required": true, "forcenew": true, "skip": true },
+		"command": { "type": "command", "required": true, "primary": true } }%s } }`
+	diffCases := []struct {
+		rename   string
+		version  string
+		replaced bool
+	}{
+		{"", "release-14.1.0", true},
+		{`, "rename": { "op": "rename ${old} to ${new}", "min_ver": "14.1.0" }`, "release-14.0.9", true},
+		{`, "rename": { "op": "rename ${old} to ${new}", "min_ver": "14.1.0" }`, "release-14.1.0", false},
+	}
+	for i, diffCase := range diffCases {
+		r := resourceShorelineObject(fmt.Sprintf(config, diffCase.rename), "action")
+		old := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{"name": "a", "command": "ls"})
+		old.SetId("a")
+		ver := ParseVersionString(diffCase.version)
+		diff, err := r.Diff(context.Background(), old.State(), terraform.NewResourceConfigRaw(map[string]interface{}{"name": "b", "command": "ls"}), &apiClient{backendVersion: &ver})
+		if err != nil {
+			t.Fatalf("diff case %d: failed to diff: %s\n", i, err.Error())
+		}
+		if diff.RequiresNew() != diffCase.replaced {
+			t.Fatalf("diff case %d: replaced: %v, expected: %v\n", i, diff.RequiresNew(), diffCase.replaced)
+		}
+		if note, hasNote := diff.Attributes["rename_note"]; !diffCase.replaced && (!hasNote || note.New != "'a' renamed in place to 'b'") {
+			t.Fatalf("diff case %d: expected an in-place rename note, got: %v\n", i, diff.Attributes)
+		}
+	}
+}
+
+func TestExtraAttributes(t *testing.T) {
+	testCases := []struct {
+		val       string
+		opVal     string
+		normalVal string
+	}{
+		{"true", "true", "true"},
+		{"3", "3", "3"},
+		{"1.0", "1.000000", "1"},
+		{"0.25", "0.250000", "0.25"},
+		{`["a", "b"]`, `[ "a", "b" ]`, `["a","b"]`},
+		{`ops "east"`, `"ops \"east\""`, `ops "east"`},
+		{"", `""`, ""},
+		// quoted, always a string
+		{`"01234"`, `"01234"`, `"01234"`},
+		{`"true"`, `"true"`, `"true"`},
+		{`"ops"`, `"ops"`, "ops"},
+	}
+	for i, testCase := range testCases {
+		opVal := extraAttrValueString("action", "field", testCase.val)
+		if opVal != testCase.opVal {
+			t.Fatalf("test case %d: op value for '%s': %s, expected: %s\n", i, testCase.val, opVal, testCase.opVal)
+		}
+		normalVal := NormalizeExtraAttrValue(testCase.val)
+		if normalVal != testCase.normalVal {
+			t.Fatalf("test case %d: normalized '%s': %s, expected: %s\n", i, testCase.val, normalVal, testCase.normalVal)
+		}
+	}
+
+	// as read back from the backend
+	backendCases := []struct {
+		val       interface{}
+		normalVal string
+	}{
+		{true, "true"},
+		{float64(3), "3"},
+		{[]interface{}{"a", "b"}, `["a","b"]`},
+		{"ops", "ops"},
+		{"01234", `"01234"`},
+		{"true", `"true"`},
+	}
+	for i, backendCase := range backendCases {
+		normalVal := normalizeBackendExtraAttrValue(backendCase.val)
+		if normalVal != backendCase.normalVal {
+			t.Fatalf("backend case %d: normalized %v: %s, expected: %s\n", i, backendCase.val, normalVal, backendCase.normalVal)
+		}
+	}
+
+	// round trip, through a backend that keeps the type of each value
+	stored := map[string]interface{}{}
+	fakeOpBackend(t, func(statement string) string {
+		parts := strings.SplitN(strings.TrimPrefix(statement, "a1."), " = ", 2)
+		var val interface{}
+		json.Unmarshal([]byte(parts[1]), &val)
+		stored[parts[0]] = val
+		return `{"update_action": {"error": {"message": ""}}}`
+	})
+	extras := map[string]interface{}{"zip": `"01234"`, "flag": `"true"`, "count": "3", "on": "true", "label": "ops"}
+	r := resourceShorelineObject(ObjectConfigJsonStr, "action")
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{"name": "a1", "command": "ls", "extra_attributes": extras})
+	if _, diags := setExtraAttributes("action", "a1", d, false); diags != nil {
+		t.Fatalf("unexpected errors setting extra attributes: %v\n", diags)
+	}
+	if stored["zip"] != "01234" || stored["flag"] != "true" || stored["count"] != float64(3) || stored["on"] != true {
+		t.Fatalf("unexpected stored extra attributes: %v\n", stored)
+	}
+	read := readExtraAttributes("action", "a1", map[string]interface{}{"attributes": stored}, d)
+	for key, val := range extras {
+		if read[key] != NormalizeExtraAttrValue(val) {
+			t.Fatalf("extra attribute %s read back as %v, expected %v\n", key, read[key], NormalizeExtraAttrValue(val))
+		}
+	}
+
+	action := resourceShorelineObject(ObjectConfigJsonStr, "action")
+	validate := action.Schema["extra_attributes"].ValidateFunc
+	if _, errs := validate(map[string]interface{}{"new_field": "1"}, "extra_attributes"); len(errs) != 0 {
+		t.Fatalf("expected new_field to be a valid extra attribute, got: %v\n", errs)
+	}
+	if _, errs := validate(map[string]interface{}{"timeout": "1"}, "extra_attributes"); len(errs) == 0 {
+		t.Fatalf("expected modeled attribute timeout to be rejected as an extra attribute\n")
+	}
+	if _, errs := validate(map[string]interface{}{"bad-name": "1"}, "extra_attributes"); len(errs) == 0 {
+		t.Fatalf("expected bad-name to be rejected as an extra attribute\n")
+	}
+}
+
+func TestActionSequence(t *testing.T) {
+	names := ReferencedObjectNames([]interface{}{"check_disk", `clean_tmp(days="7")`, "check_disk"})
+	if !reflect.DeepEqual(names, []string{"check_disk", "clean_tmp"}) {
+		t.Fatalf("unexpected referenced actions: %v\n", names)
+	}
+
+	sequence := resourceShorelineObject(ObjectConfigJsonStr, "action_sequence")
+	validate := sequence.Schema["steps"].Elem.(*schema.Schema).ValidateFunc
+	testCases := []struct {
+		step      string
+		shouldErr bool
+	}{
+		{"check_disk", false},
+		{`clean_tmp(days="7")`, false},
+		{"hosts | check_disk", true},
+		{"1st_step", true},
+	}
+	for i, testCase := range testCases {
+		_, errs := validate(testCase.step, "steps")
+		if (len(errs) > 0) != testCase.shouldErr {
+			t.Fatalf("test case %d: step '%s' errors: %v, expected error: %v\n", i, testCase.step, errs, testCase.shouldErr)
+		}
+	}
+	if sequence.Schema["stop_on_failure"].Default != true {
+		t.Fatalf("expected stop_on_failure to default to true\n")
+	}
+}
+
+func TestMetricReferences(t *testing.T) {
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	testCases := []struct {
+		typ      string
+		policies map[string]string
+	}{
+		{"metric", map[string]string{
+			"alarm.fire_query":             "disable",
+			"alarm.metric_name":            "disable",
+			"derived_metric.input_metrics": "keep",
+			"metric_set.metrics":           "detach",
+		}},
+		{"derived_metric", map[string]string{
+			"alarm.clear_query":            "disable",
+			"alarm.metric_name":            "disable",
+			"derived_metric.input_metrics": "keep",
+			"metric_set.metrics":           "detach",
+		}},
+		{"metric_set", map[string]string{
+			"alarm.fire_query":  "disable",
+			"alarm.metric_name": "disable",
+		}},
+	}
+	for i, testCase := range testCases {
+		policies := map[string]string{}
+		for _, r := range objectReferrerTypes(objects, testCase.typ) {
+			policies[r.typ+"."+r.key] = r.policy
+		}
+		for key, policy := range testCase.policies {
+			if policies[key] != policy {
+				t.Fatalf("test case %d: expected %s to reference %s with policy '%s', got: %v\n", i, key, testCase.typ, policy, policies)
+			}
+		}
+	}
+
+	metricSet := resourceShorelineObject(ObjectConfigJsonStr, "metric_set")
+	if !metricSet.Schema["resource_type"].Required {
+		t.Fatalf("expected metric_set resource_type to be required\n")
+	}
+}
+
+func TestIntegrationServiceParams(t *testing.T) {
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	attrs := GetNestedValueOrDefault(objects, ToKeyPath("integration.attributes"), nil).(map[string]interface{})
+	services := GetNestedValueOrDefault(objects, ToKeyPath("integration.services"), nil).(map[string]interface{})
+
+	vals := map[string]interface{}{"api_key": "k1", "app_key": "k2", "dashboard_name": "", "webhook_name": "hook"}
+	packed, err := PackObjectParams(attrs, vals, `{"dashboard_name": "old", "region": "us1"}`)
+	if err != nil {
+		t.Fatalf("failed to pack params: %s\n", err.Error())
+	}
+	packedJs, _ := StringToJson(packed)
+	expected := map[string]interface{}{"api_key": "k1", "app_key": "k2", "webhook_name": "hook", "region": "us1"}
+	if !reflect.DeepEqual(packedJs, expected) {
+		t.Fatalf("packed params: %s, expected: %v\n", packed, expected)
+	}
+	unpacked, err := UnpackObjectParams(attrs, packed)
+	if err != nil {
+		t.Fatalf("failed to unpack params: %s\n", err.Error())
+	}
+	delete(vals, "dashboard_name")
+	if !reflect.DeepEqual(unpacked, vals) {
+		t.Fatalf("unpacked params: %v, expected: %v\n", unpacked, vals)
+	}
+
+	testCases := []struct {
+		service   string
+		set       []string
+		unknown   []string
+		shouldErr bool
+	}{
+		{"datadog", []string{"api_key", "app_key", "webhook_name"}, nil, false},
+		{"datadog", []string{"api_key"}, nil, true},
+		{"datadog", []string{"api_key", "app_key", "routing_key"}, nil, true},
+		{"datadog", []string{"dashboard_name"}, []string{"api_key", "app_key"}, false},
+		{"newrelic", []string{"account_id", "insights_collector_url", "insights_collector_api_key", "incident_management_url"}, nil, false},
+		{"slack", []string{"workspace_name"}, nil, true},
+		{"pagerduty", []string{"routing_key", "api_key"}, nil, false},
+		{"opsgenie", []string{"api_key"}, nil, true},
+	}
+	for i, testCase := range testCases {
+		isSet := func(key string) (bool, bool) {
+			for _, k := range testCase.unknown {
+				if k == key {
+					return false, false
+				}
+			}
+			for _, k := range testCase.set {
+				if k == key {
+					return true, true
+				}
+			}
+			return false, true
+		}
+		err := ValidateServiceParams(attrs, services, testCase.service, isSet)
+		if (err != nil) != testCase.shouldErr {
+			t.Fatalf("test case %d: %s params %v error: %v, expected error: %v\n", i, testCase.service, testCase.set, err, testCase.shouldErr)
+		}
+	}
+}
+
+func TestOpPack(t *testing.T) {
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	manifestJs := `{
+		"name": "jvm_trace", "version": "1.0.0",
+		"variables": { "namespace": { "default": "jvm" }, "resource_query": {} },
+		"objects": [
+			{ "type": "bot", "name": "${var.namespace}_bot", "attributes": { "command": "if ${var.namespace}_alarm then ${var.namespace}_dump fi" } },
+			{ "type": "alarm", "name": "${var.namespace}_alarm", "attributes": { "fire_query": "${var.namespace}_check() == 1", "resource_query": "${var.resource_query}" } },
+			{ "type": "action", "name": "${var.namespace}_check", "attributes": { "command": "echo", "resource_query": "${var.resource_query}" } },
+			{ "type": "action", "name": "${var.namespace}_dump", "attributes": { "command": "dump" }, "depends_on": ["file:${var.namespace}_script"] },
+			{ "type": "file", "name": "${var.namespace}_script", "attributes": { "destination_path": "/tmp/x" } }
+		]
+	}`
+	manifest, err := ParseOpPackManifest(manifestJs)
+	if err != nil {
+		t.Fatalf("failed to parse op pack manifest: %s\n", err.Error())
+	}
+	if _, err := RenderOpPack(manifest, map[string]interface{}{}, "", objects); err == nil || !strings.Contains(err.Error(), "resource_query") {
+		t.Fatalf("expected an error for the missing variable, got: %v\n", err)
+	}
+	if _, err := RenderOpPack(manifest, map[string]interface{}{"resource_query": "hosts", "other": "x"}, "", objects); err == nil {
+		t.Fatalf("expected an error for the undeclared variable\n")
+	}
+
+	rendered, err := RenderOpPack(manifest, map[string]interface{}{"resource_query": "hosts"}, "", objects)
+	if err != nil {
+		t.Fatalf("failed to render op pack: %s\n", err.Error())
+	}
+	order := []string{}
+	for _, obj := range rendered {
+		order = append(order, obj.key())
+	}
+	expected := "action:jvm_check,alarm:jvm_alarm,file:jvm_script,action:jvm_dump,bot:jvm_bot"
+	if strings.Join(order, ",") != expected {
+		t.Fatalf("expected install order %s, got: %s\n", expected, strings.Join(order, ","))
+	}
+	if rendered[1].Attributes["resource_query"] != "hosts" {
+		t.Fatalf("expected variables to be substituted, got: %v\n", rendered[1].Attributes)
+	}
+
+	// only the changed object gets a new hash
+	changed, _ := RenderOpPack(manifest, map[string]interface{}{"resource_query": "pods"}, "", objects)
+	for i, obj := range changed {
+		same := obj.Hash == rendered[i].Hash
+		if same != (obj.Type == "bot" || obj.Type == "file" || obj.Name == "jvm_dump") {
+			t.Fatalf("unexpected hash change of %s: %v\n", obj.key(), !same)
+		}
+	}
+
+	cyclic := []opPackObject{
+		{Type: "bot", Name: "b", DependsOn: []string{"a"}},
+		{Type: "action", Name: "a", DependsOn: []string{"bot:b"}},
+	}
+	if _, err := SortOpPackObjects(cyclic, objects); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Fatalf("expected a circular dependency error, got: %v\n", err)
+	}
+	if _, err := ParseOpPackManifest(`{"name": "x", "version": "1", "objects": [], "extra": 1}`); err == nil {
+		t.Fatalf("expected an error for an invalid manifest\n")
+	}
+}
+
+func TestActionRun(t *testing.T) {
+	op, _ := actionRunOp("warm_cache", "pods | app=\"web\"", map[string]interface{}{"SIZE": "10"})
+	expected := `run_action( action_name = "warm_cache", resource_query = "pods | app=\"web\"", params = "{\"SIZE\":\"10\"}" )`
+	if op != expected {
+		t.Fatalf("expected op %s, got: %s\n", expected, op)
+	}
+
+	js, _ := StringToJson(`{"get_action_job": {"status": "COMPLETED", "resources": [
+		{"resource_name": "web-2", "exit_status": 1, "stdout": "miss"},
+		{"resource_name": "web-1", "exit_status": 0, "stdout": "ok"},
+		{"resource_name": "web-3", "stdout": "lost"}]}}`)
+	status, results, failed := ParseActionJob(js)
+	if !runIsDone(status) || failed != 2 || len(results) != 3 {
+		t.Fatalf("unexpected job status '%s', %d failed of %v\n", status, failed, results)
+	}
+	first := results[0].(map[string]interface{})
+	if first["resource_name"] != "web-1" || first["stdout"] != "ok" || first["exit_status"] != 0 {
+		t.Fatalf("expected results sorted by resource, got: %v\n", results)
+	}
+	// a missing exit status isn't a success
+	if last := results[2].(map[string]interface{}); last["resource_name"] != "web-3" || last["exit_status"] != exitStatusUnknown {
+		t.Fatalf("expected an unknown exit status for web-3, got: %v\n", last)
+	}
+	failureCases := []struct {
+		status   string
+		results  []interface{}
+		expected string
+	}{
+		{"COMPLETED", results[:2], "failed on 1 of 2 resources: web-2 (exit status 1)"},
+		{"COMPLETED", results[:1], ""},
+		{"COMPLETED", results[2:], "failed on 1 of 1 resources: web-3 (no exit status)"},
+		{"FAILED", []interface{}{}, "finished with status 'FAILED'"},
+		{"TIMED_OUT", []interface{}{}, "finished with status 'TIMED_OUT'"},
+		{"CANCELLED", results[:2], "finished with status 'CANCELLED', and failed on 1 of 2 resources: web-2 (exit status 1)"},
+	}
+	for _, c := range failureCases {
+		if failure := describeActionRunFailure(c.status, c.results); failure != c.expected {
+			t.Fatalf("expected failure '%s' for a %s job, got: '%s'\n", c.expected, c.status, failure)
+		}
+	}
+	if runIsDone("RUNNING") {
+		t.Fatalf("expected a running job not to be done\n")
+	}
+}
+
+func TestNotebookRun(t *testing.T) {
+	op, _ := notebookRunOp("restart_pods", map[string]interface{}{"APP": "web"})
+	expected := `run_notebook( notebook_name = "restart_pods", params = "{\"APP\":\"web\"}" )`
+	if op != expected {
+		t.Fatalf("expected op %s, got: %s\n", expected, op)
+	}
+
+	testCases := []struct {
+		js       string
+		done     bool
+		approval bool
+		success  bool
+		cells    int
+	}{
+		{`{"get_notebook_run": {"status": "RUNNING", "cells": [{"status": "completed"}, {"status": "running"}]}}`, false, false, false, 2},
+		{`{"get_notebook_run": {"status": "PENDING_APPROVAL", "approvers": ["sre", "alice"]}}`, false, true, false, 0},
+		{`{"get_notebook_run": {"status": "COMPLETED", "cells": [{"status": "completed", "output": "ok"}]}}`, true, false, true, 1},
+		{`{"get_notebook_run": {"status": "FAILED", "cells": [{"status": "failed", "output": "error"}]}}`, true, false, false, 1},
+	}
+	for i, testCase := range testCases {
+		js, _ := StringToJson(testCase.js)
+		status, approvers, cells := ParseNotebookRun(js)
+		if runIsDone(status) != testCase.done || runNeedsApproval(status) != testCase.approval || runSucceeded(status) != testCase.success {
+			t.Fatalf("test case %d: unexpected handling of status '%s'\n", i, status)
+		}
+		if len(cells) != testCase.cells {
+			t.Fatalf("test case %d: expected %d cells, got: %v\n", i, testCase.cells, cells)
+		}
+		if testCase.approval && strings.Join(approvers, ",") != "alice,sre" {
+			t.Fatalf("test case %d: expected sorted approvers, got: %v\n", i, approvers)
+		}
+	}
+
+	// runs needing approval aren't started, or are cancelled rather than left pending
+	runCases := []struct {
+		approvers string
+		runStatus string
+		expected  []string
+		errMatch  string
+	}{
+		{`["sre"]`, "COMPLETED", []string{}, "wasn't run"},
+		{`[]`, "PENDING_APPROVAL", []string{"run_notebook", "get_notebook_run", "cancel_notebook_run"}, "was cancelled"},
+		{`[]`, "COMPLETED", []string{"run_notebook", "get_notebook_run"}, ""},
+	}
+	r := resourceShorelineNotebookRun(ObjectConfigJsonStr)
+	for i, runCase := range runCases {
+		started := []string{}
+		fakeOpBackend(t, func(statement string) string {
+			switch {
+			case strings.HasPrefix(statement, "list notebooks"):
+				return `{"list_type": {"symbol": [{"attributes": {"name": "nb", "approvers": ` + runCase.approvers + `}}]}}`
+			case strings.HasPrefix(statement, "get_notebook_class"):
+				return `{"get_notebook_class": {"notebook_classes": [{"name": "nb"}]}}`
+			case strings.HasPrefix(statement, "run_notebook"):
+				started = append(started, "run_notebook")
+				return `{"run_notebook": {"run_id": "r1"}}`
+			case strings.HasPrefix(statement, "get_notebook_run"):
+				started = append(started, "get_notebook_run")
+				return `{"get_notebook_run": {"status": "` + runCase.runStatus + `"}}`
+			case strings.HasPrefix(statement, "cancel_notebook_run"):
+				started = append(started, "cancel_notebook_run")
+				return `{"cancel_notebook_run": {}}`
+			}
+			return `{"error": {"message": "unknown op"}}`
+		})
+		d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{"notebook_name": "nb"})
+		diags := r.CreateContext(context.Background(), d, &apiClient{})
+		if !reflect.DeepEqual(started, runCase.expected) {
+			t.Fatalf("run case %d: expected ops %v, got: %v\n", i, runCase.expected, started)
+		}
+		if runCase.errMatch == "" && diags.HasError() || runCase.errMatch != "" && (!diags.HasError() || !strings.Contains(diags[0].Summary, runCase.errMatch)) {
+			t.Fatalf("run case %d: expected error matching '%s', got: %v\n", i, runCase.errMatch, diags)
+		}
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	filters := map[string]string{"object_type": "bot", "user": "alice", "since": "2021-07-01T00:00:00Z"}
+	op := auditEventsOp(filters)
+	expected := `audit_events( object_type = "bot", user = "alice", since = "2021-07-01T00:00:00Z" )`
+	if op != expected {
+		t.Fatalf("expected op %s, got: %s\n", expected, op)
+	}
+
+	js, _ := StringToJson(`{"audit_events": {"events": [
+		{"user": "alice", "action": "update", "object_type": "BOT", "object_name": "b1", "before": {"enabled": true}, "after": {"enabled": false}, "timestamp": "2021-07-03T10:00:00+02:00"},
+		{"user": "alice", "action": "create", "object_type": "bot", "object_name": "b1", "after": {"enabled": true}, "timestamp": "2021-07-02T10:00:00Z"},
+		{"user": "bob", "action": "delete", "object_type": "bot", "object_name": "b2", "timestamp": "2021-07-04T10:00:00Z"},
+		{"user": "alice", "action": "create", "object_type": "action", "object_name": "a1", "timestamp": "2021-07-05T10:00:00Z"},
+		{"user": "alice", "action": "create", "object_type": "bot", "object_name": "b0", "timestamp": "2021-06-30T10:00:00Z"}]}}`)
+	events, err := ParseAuditEvents(js, filters, 0)
+	if err != nil {
+		t.Fatalf("failed to parse audit events: %s\n", err.Error())
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got: %v\n", events)
+	}
+	first, second := events[0].(map[string]interface{}), events[1].(map[string]interface{})
+	if first["action"] != "create" || first["before"] != "" || first["after"] != `{"enabled":true}` {
+		t.Fatalf("unexpected first event: %v\n", first)
+	}
+	if second["timestamp"] != "2021-07-03T08:00:00Z" || second["object_type"] != "bot" {
+		t.Fatalf("unexpected second event: %v\n", second)
+	}
+
+	events, _ = ParseAuditEvents(js, map[string]string{}, 2)
+	if len(events) != 2 || events[1].(map[string]interface{})["object_name"] != "a1" {
+		t.Fatalf("expected the 2 most recent events, got: %v\n", events)
+	}
+
+	// older backends don't have the op
+	asked := false
+	fakeOpBackend(t, func(statement string) string {
+		asked = true
+		return `{"audit_events": {"events": []}}`
+	})
+	r := dataSourceShorelineAuditEvents()
+	for version, supported := range map[string]bool{"release-14.1.0": false, "release-" + opMinVersions[auditEventsOpName]: true} {
+		asked = false
+		ver := ParseVersionString(version)
+		d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{})
+		diags := r.ReadContext(context.Background(), d, &apiClient{backendVersion: &ver})
+		if supported != (!diags.HasError() && asked) || !supported && (asked || !strings.Contains(diags[0].Summary, "not supported")) {
+			t.Fatalf("backend %s: expected supported %v, got: asked %v, %v\n", version, supported, asked, diags)
+		}
+	}
+}
+
+func TestObjectAccess(t *testing.T) {
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	lists := accessListObjectTypes(objects)
+	if strings.Join(lists["action"], ",") != "allowed_entities" || strings.Join(lists["notebook"], ",") != "allowed_entities,approvers" {
+		t.Fatalf("unexpected access lists: %v\n", lists)
+	}
+	if _, hasLists := lists["bot"]; hasLists {
+		t.Fatalf("expected bots not to have access lists\n")
+	}
+
+	testCases := []struct {
+		current  []interface{}
+		add      []interface{}
+		remove   []interface{}
+		expected string
+	}{
+		{[]interface{}{"alice", "bob"}, []interface{}{"sre", "alice"}, nil, "alice,bob,sre"},
+		{[]interface{}{"alice", "sre", "bob"}, nil, []interface{}{"sre"}, "alice,bob"},
+		{[]interface{}{}, []interface{}{"sre"}, []interface{}{"bob"}, "sre"},
+		{[]interface{}{"bob", "bob"}, []interface{}{"carol"}, []interface{}{"dave"}, "bob,carol"},
+	}
+	for i, testCase := range testCases {
+		out := []string{}
+		for _, e := range UpdateAccessList(testCase.current, testCase.add, testCase.remove) {
+			out = append(out, e.(string))
+		}
+		if strings.Join(out, ",") != testCase.expected {
+			t.Fatalf("test case %d: expected %s, got: %v\n", i, testCase.expected, out)
+		}
+	}
+
+	if accessListOrder(true)[0] != "allowed_entities" || accessListOrder(false)[0] != "approvers" {
+		t.Fatalf("unexpected access list order\n")
+	}
+	if id := objectAccessId("notebook", "nb", "approvers", []interface{}{"sre", "alice"}); id != "notebook:nb:approvers:alice,sre" {
+		t.Fatalf("unexpected id: %s\n", id)
+	}
+}
+
+func TestFileSourceDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source_dir")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s\n", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	write := func(rel string, data string, mode os.FileMode) {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := ioutil.WriteFile(p, []byte(data), mode); err != nil {
+			t.Fatalf("failed to write %s: %s\n", rel, err.Error())
+		}
+	}
+	write("jvm_dumps.sh", "#!/bin/sh\n", 0755)
+	write("lib/agent.jar", "jar", 0644)
+	write("lib/notes.txt", "notes", 0644)
+	write("logs/run.log", "log", 0644)
+
+	testCases := []struct {
+		include  []string
+		exclude  []string
+		expected string
+	}{
+		{nil, nil, "jvm_dumps.sh,lib/agent.jar,lib/notes.txt,logs/run.log"},
+		{[]string{"*.jar", "*.sh"}, nil, "jvm_dumps.sh,lib/agent.jar"},
+		{nil, []string{"logs", "*.txt"}, "jvm_dumps.sh,lib/agent.jar"},
+		{[]string{"lib/*"}, []string{"lib/notes.txt"}, "lib/agent.jar"},
+	}
+	for i, testCase := range testCases {
+		files, err := ListSourceDir(dir, testCase.include, testCase.exclude)
+		if err != nil {
+			t.Fatalf("test case %d: unexpected error: %s\n", i, err.Error())
+		}
+		paths := []string{}
+		for _, f := range files {
+			paths = append(paths, f.Path)
+		}
+		if strings.Join(paths, ",") != testCase.expected {
+			t.Fatalf("test case %d: expected %s, got: %v\n", i, testCase.expected, paths)
+		}
+	}
+	if _, err := ListSourceDir(dir, []string{"[a-"}, nil); err == nil {
+		t.Fatalf("expected an error for an invalid glob\n")
+	}
+
+	tarball, size, sum, err := PackSourceDir(dir, nil, []string{"logs"})
+	if err != nil {
+		t.Fatalf("failed to pack: %s\n", err.Error())
+	}
+	defer os.Remove(tarball)
+	in, _ := os.Open(tarball)
+	defer in.Close()
+	tr := tar.NewReader(in)
+	packed := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tarball: %s\n", err.Error())
+		}
+		packed = append(packed, fmt.Sprintf("%s:%o", hdr.Name, hdr.Mode))
+	}
+	if strings.Join(packed, ",") != "jvm_dumps.sh:755,lib/agent.jar:644,lib/notes.txt:644" {
+		t.Fatalf("unexpected tarball entries: %v\n", packed)
+	}
+	if fstat, _ := os.Stat(tarball); fstat.Size() != size {
+		t.Fatalf("expected size %d, got: %d\n", fstat.Size(), size)
+	}
+
+	// the checksum only depends on the packed files
+	os.Chtimes(filepath.Join(dir, "lib/agent.jar"), time.Unix(1000, 0), time.Unix(1000, 0))
+	files, _ := ListSourceDir(dir, nil, []string{"logs"})
+	if SourceDirChecksum(files) != sum {
+		t.Fatalf("expected the checksum not to change with times\n")
+	}
+	write("lib/agent.jar", "jar2", 0644)
+	files, _ = ListSourceDir(dir, nil, []string{"logs"})
+	if SourceDirChecksum(files) == sum {
+		t.Fatalf("expected the checksum to change with content\n")
+	}
+}
+
+func TestFileContent(t *testing.T) {
+	res := resourceShorelineObject(ObjectConfigJsonStr, "file")
+	base := map[string]interface{}{"name": "cfg", "destination_path": "/etc/app.conf", "resource_query": "host"}
+	withSource := func(key string, val interface{}) map[string]interface{} {
+		raw := map[string]interface{}{key: val}
+		for k, v := range base {
+			raw[k] = v
+		}
+		return raw
+	}
+
+	testCases := []struct {
+		raw      map[string]interface{}
+		expected string
+		err      bool
+	}{
+		{withSource("content", "port = 8080\n"), "port = 8080\n", false},
+		{withSource("content_base64", base64.StdEncoding.EncodeToString([]byte{0, 1, 2})), "\x00\x01\x02", false},
+		{withSource("content_base64", "not base64!"), "", true},
+		{withSource("input_file", "/tmp/app.conf"), "", false},
+	}
+	for i, testCase := range testCases {
+		d := schema.TestResourceDataRaw(t, res.Schema, testCase.raw)
+		data, _, err := fileContent(d)
+		if (err != nil) != testCase.err || string(data) != testCase.expected {
+			t.Fatalf("test case %d: expected '%s' (error: %v), got: '%s' (%v)\n", i, testCase.expected, testCase.err, data, err)
+		}
+	}
+
+	// exactly one source of data
+	if diags := res.Validate(terraform.NewResourceConfigRaw(base)); !diags.HasError() {
+		t.Fatalf("expected an error without any file data\n")
+	}
+	both := withSource("content", "x")
+	both["input_file"] = "/tmp/app.conf"
+	if diags := res.Validate(terraform.NewResourceConfigRaw(both)); !diags.HasError() {
+		t.Fatalf("expected an error with both content and input_file\n")
+	}
+	if diags := res.Validate(terraform.NewResourceConfigRaw(withSource("content", "x"))); diags.HasError() {
+		t.Fatalf("unexpected error: %v\n", diags)
+	}
+
+	// uploaded like an input_file, with the same checksum and length as planned
+	tmpFile, err := writeFileContent([]byte("port = 8080\n"))
+	if err != nil {
+		t.Fatalf("failed to write content: %s\n", err.Error())
+	}
+	defer os.Remove(tmpFile)
+	_, ok, size, sum := FileToBase64(tmpFile, true)
+	if !ok || size != 12 || sum != fmt.Sprintf("%x", md5.Sum([]byte("port = 8080\n"))) {
+		t.Fatalf("unexpected file: %v %d %s\n", ok, size, sum)
+	}
+}
+
+func TestFileUpload(t *testing.T) {
+	parts := []string{}
+	for _, p := range UploadParts(10, 4) {
+		parts = append(parts, fmt.Sprintf("%d:%d+%d", p.Number, p.Offset, p.Length))
+	}
+	if strings.Join(parts, ",") != "1:0+4,2:4+4,3:8+2" {
+		t.Fatalf("unexpected parts: %v\n", parts)
+	}
+
+	sum := fmt.Sprintf("%x", md5.Sum([]byte("data")))
+	etagCases := []struct {
+		etag string
+		err  bool
+	}{
+		{"\"" + sum + "\"", false},
+		{strings.ToUpper(sum), false},
+		{"\"0123456789abcdef0123456789abcdef\"", true},
+		{"\"" + sum + "-2\"", false}, // not an md5, e.g. multipart or encrypted
+		{"", false},
+	}
+	for i, etagCase := range etagCases {
+		if err := checkUploadEtag(etagCase.etag, sum); (err != nil) != etagCase.err {
+			t.Fatalf("etag case %d: expected error %v, got: %v\n", i, etagCase.err, err)
+		}
+	}
+
+	js, _ := StringToJson(`{"start_file_upload": {"upload_id": "u1", "parts": [{"part_number": 1, "url": "https://a/1"}, {"part_number": 2, "url": "https://a/2"}]}}`)
+	uploadId, urls, err := ParseStartFileUpload(js)
+	if err != nil || uploadId != "u1" || len(urls) != 2 || urls[2] != "https://a/2" {
+		t.Fatalf("unexpected start_file_upload: %s %v %v\n", uploadId, urls, err)
+	}
+	if _, _, err := ParseStartFileUpload(map[string]interface{}{}); err == nil {
+		t.Fatalf("expected an error without an upload_id\n")
+	}
+
+	// a server that fails the first upload of part 2, and records the parts uploaded
+	uploaded := []string{}
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/2" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		uploaded = append(uploaded, r.URL.Path)
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(body)))
+	}))
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "upload")
+	defer os.RemoveAll(dir)
+	os.Setenv("SHORELINE_UPLOAD_STATE_DIR", dir)
+	defer os.Unsetenv("SHORELINE_UPLOAD_STATE_DIR")
+	src := filepath.Join(dir, "data")
+	ioutil.WriteFile(src, []byte("0123456789"), 0644)
+	file, _ := os.Open(src)
+	defer file.Close()
+	serverUrls := map[int]string{1: server.URL + "/1", 2: server.URL + "/2", 3: server.URL + "/3"}
+
+	// part 1 was uploaded by an earlier (failed) apply
+	prior := loadFileUpload("big", "m", 10, 4)
+	prior.UploadId = "u1"
+	prior.Etags[1] = fmt.Sprintf("%x", md5.Sum([]byte("0123")))
+	prior.save()
+	if other := loadFileUpload("big", "changed", 10, 4); other.UploadId != "" {
+		t.Fatalf("expected changed data not to resume\n")
+	}
+	resumed := loadFileUpload("big", "m", 10, 4)
+	if resumed.UploadId != "u1" || len(resumed.Etags) != 1 {
+		t.Fatalf("expected the upload to resume, got: %+v\n", resumed)
+	}
+	if err := resumed.uploadParts(context.Background(), file, serverUrls); err != nil {
+		t.Fatalf("unexpected upload error: %s\n", err.Error())
+	}
+	if strings.Join(uploaded, ",") != "/2,/3" || !failed {
+		t.Fatalf("unexpected uploads: %v\n", uploaded)
+	}
+	if saved := loadFileUpload("big", "m", 10, 4); len(saved.Etags) != 3 || saved.Etags[3] != fmt.Sprintf("%x", md5.Sum([]byte("89"))) {
+		t.Fatalf("expected all parts to be saved, got: %+v\n", saved)
+	}
+	op := completeFileUploadOp(resumed)
+	if !strings.HasPrefix(op, "complete_file_upload( file_name = \"big\", upload_id = \"u1\", parts = \"[{\\\"etag\\\":") {
+		t.Fatalf("unexpected op: %s\n", op)
+	}
+
+	storedCases := []struct {
+		result string
+		err    string
+	}{
+		{`{"complete_file_upload": {"md5": "` + sum + `"}}`, ""},
+		{`{"complete_file_upload": {"md5": "0123456789abcdef0123456789abcdef"}}`, "stored object has md5"},
+		{`{"complete_file_upload": {}}`, "did not return an md5"},
+	}
+	for i, storedCase := range storedCases {
+		err := checkStoredMd5(storedCase.result, sum)
+		if (storedCase.err == "" && err != nil) || (storedCase.err != "" && (err == nil || !strings.Contains(err.Error(), storedCase.err))) {
+			t.Fatalf("stored case %d: expected error '%s', got: %v\n", i, storedCase.err, err)
+		}
+	}
+
+	// network errors are reported (not a crash)
+	if _, err := putFileRange(context.Background(), file, 0, 10, "http://127.0.0.1:1/data"); err == nil {
+		t.Fatalf("expected an upload error\n")
+	}
+
+	// older backends don't get the multipart ops: large files fall back to a single PUT, up to its limit
+	statements := []string{}
+	fakeOpBackend(t, func(statement string) string {
+		statements = append(statements, statement)
+		return `{}`
+	})
+	ver := ParseVersionString("release-14.1.0")
+	oldBackend := &apiClient{backendVersion: &ver}
+	err = uploadFileObject(context.Background(), oldBackend, "big", src, "m", uploadPartSizeDefault+1)
+	if err == nil || len(statements) != 1 || strings.Contains(statements[0], startFileUploadOpName) || !strings.Contains(statements[0], "presigned_put") {
+		t.Fatalf("expected a single PUT, got: %v %v\n", statements, err)
+	}
+	statements = statements[:0]
+	err = uploadFileObject(context.Background(), oldBackend, "big", src, "m", uploadSinglePutMax+1)
+	if err == nil || !strings.Contains(err.Error(), "not supported by backend version") || len(statements) != 0 {
+		t.Fatalf("expected a not supported error, got: %v %v\n", statements, err)
+	}
+}
+
+func TestEncodeFileData(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "file_data")
+	defer os.RemoveAll(dir)
+	raw := []byte(strings.Repeat("jvm heap dump line\n", 100000))
+	rand.New(rand.NewSource(1)).Read(raw[:4096])
+	src := filepath.Join(dir, "data")
+	ioutil.WriteFile(src, raw, 0644)
+	decoder, _ := zstd.NewReader(nil)
+	defer decoder.Close()
+
+	for _, level := range []int{1, 3, 19} {
+		encoded, size, sum, err := EncodeFileData(src, false, level, 0)
+		if err != nil {
+			t.Fatalf("level %d: unexpected error: %s\n", level, err.Error())
+		}
+		compressed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatalf("level %d: invalid base64: %s\n", level, err.Error())
+		}
+		decoded, err := decoder.DecodeAll(compressed, nil)
+		if err != nil || !reflect.DeepEqual(decoded, raw) {
+			t.Fatalf("level %d: data doesn't round-trip (%v)\n", level, err)
+		}
+		if size != int64(len(raw)) || sum != fmt.Sprintf("%x", md5.Sum(raw)) || len(compressed) >= len(raw) {
+			t.Fatalf("level %d: unexpected size %d, md5 %s or compressed size %d\n", level, size, sum, len(compressed))
+		}
+	}
+
+	// presigned uploads only need the size and md5, and aren't limited
+	encoded, size, sum, err := EncodeFileData(src, true, 3, 1024)
+	if err != nil || encoded != "" || size != int64(len(raw)) || sum != fmt.Sprintf("%x", md5.Sum(raw)) {
+		t.Fatalf("unexpected skipped data: %d %s %v\n", size, sum, err)
+	}
+	if _, _, _, err := EncodeFileData(src, false, 3, 1024); err == nil || !strings.Contains(err.Error(), "max_inline_file_size") {
+		t.Fatalf("expected a size limit error, got: %v\n", err)
+	}
+	empty := filepath.Join(dir, "empty")
+	ioutil.WriteFile(empty, nil, 0644)
+	if _, _, _, err := EncodeFileData(empty, false, 3, 0); err == nil {
+		t.Fatalf("expected an error for an empty file\n")
+	}
+	if _, ok, _, _ := FileToBase64(filepath.Join(dir, "missing"), false); ok {
+		t.Fatalf("expected a missing file to fail\n")
+	}
+}
+
+// Points the op client at a fake backend, which answers each op statement with 'answer'.
+func fakeOpBackend(t *testing.T, answer func(statement string) string) {
+	claim := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"aud": "access", "exp": %d}`, time.Now().Unix()+3600)))
+	token := "e30." + claim + ".c2ln"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		raw, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(raw, &body)
+		w.Write([]byte(answer(body["statement"])))
+	}))
+	saved, savedRetries := GlobalOpts, RetryLimit
+	GlobalOpts = CliOpts{HasAuth: true, AuthChanged: true, Url: server.URL, Token: token}
+	RetryLimit = 0
+	t.Cleanup(func() {
+		server.Close()
+		GlobalOpts, RetryLimit = saved, savedRetries
+		GlobalOpts.AuthChanged = true
+	})
+}
+
+func TestFailedUpdateState(t *testing.T) {
+	// a metric whose "units" can't be set
+	remote := map[string]interface{}{"name": "m1", "val": "cpu_usage", "description": "old", "units": "%"}
+	ops := fakeMetricBackend(t, map[string]map[string]interface{}{"m1": remote}, map[string]bool{"m1.units": true})
+
+	ctx := context.Background()
+	meta := &apiClient{}
+	r := resourceShorelineObject(ObjectConfigJsonStr, "metric")
+	old := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{"name": "m1", "value": "cpu_usage", "description": "old", "units": "%"})
+	old.SetId("m1")
+	state := old.State()
+	diff, err := r.Diff(ctx, state, terraform.NewResourceConfigRaw(map[string]interface{}{"name": "m1", "value": "cpu_usage", "description": "new", "units": "?"}), meta)
+	if err != nil {
+		t.Fatalf("failed to diff: %s\n", err)
+	}
+	nuState, diags := r.Apply(ctx, state, diff, meta)
+	if !diags.HasError() {
+		t.Fatalf("expected the update to fail, ops: %v\n", *ops)
+	}
+	// the written field was rolled back, and the state keeps the prior config
+	if remote["description"] != "old" {
+		t.Fatalf("expected the description to be rolled back, got: %v (ops: %v)\n", remote["description"], *ops)
+	}
+	if nuState == nil || nuState.Attributes["description"] != "old" || nuState.Attributes["units"] != "%" {
+		t.Fatalf("expected the prior state after a failed update, got: %v\n", nuState)
+	}
+}
+
+func TestRestoreServiceParams(t *testing.T) {
+	objects, _ := StringToJson(ObjectConfigJsonStr)
+	attrs := GetNestedValueOrDefault(objects, ToKeyPath("integration.attributes"), nil).(map[string]interface{})
+
+	// the params after a failed update, which set dashboard_name, webhook_name and api_key
+	params := `{"api_key": "k2", "dashboard_name": "new", "webhook_name": "hook", "region": "us1"}`
+	ops := []string{}
+	fakeOpBackend(t, func(statement string) string {
+		ops = append(ops, statement)
+		switch {
+		case strings.HasPrefix(statement, "list integrations"):
+			return `{"list_type": {"symbol": [{"attributes": {"name": "i1"}}]}}`
+		case strings.HasPrefix(statement, "get_integration_class"):
+			js, _ := json.Marshal(map[string]interface{}{"get_integration_class": map[string]interface{}{"integration_classes": []interface{}{map[string]interface{}{"name": "i1", "params": params}}}})
+			return string(js)
+		case strings.HasPrefix(statement, "i1.params = "):
+			params = strings.TrimPrefix(statement, "i1.params = ")
+		}
+		return `{"update_integration": {"error": {"message": ""}}}`
+	})
+
+	snapshot := map[string]interface{}{"dashboard_name": "old"}
+	written := map[string]bool{"dashboard_name": true, "webhook_name": true, "api_key": true}
+	diags := resourceShorelineObjectRestore(&apiClient{}, "integration", attrs, "i1", snapshot, written)
+	if diags.HasError() {
+		t.Fatalf("failed to restore: %v (ops: %v)\n", diags, ops)
+	}
+	for _, op := range ops {
+		if strings.HasPrefix(op, "i1.") && !strings.HasPrefix(op, "i1.params = ") {
+			t.Fatalf("expected params to be restored packed, got: %s\n", op)
+		}
+	}
+	unquoted := ""
+	if json.Unmarshal([]byte(params), &unquoted) != nil {
+		t.Fatalf("expected a quoted params string, got: %s\n", params)
+	}
+	restored, _ := StringToJson(unquoted)
+	// webhook_name wasn't set before, and the write-only api_key can't be restored
+	expected := map[string]interface{}{"api_key": "k2", "dashboard_name": "old", "region": "us1"}
+	if !reflect.DeepEqual(restored, expected) {
+		t.Fatalf("restored params: %v, expected: %v\n", restored, expected)
+	}
+}
+
+// A fake backend with a store of metrics, which fails to set the fields in 'failing'.
+func fakeMetricBackend(t *testing.T, metrics map[string]map[string]interface{}, failing map[string]bool) *[]string {
+	ops := []string{}
+	fakeOpBackend(t, func(statement string) string {
+		ops = append(ops, statement)
+		if strings.HasPrefix(statement, "list metrics") {
+			symbols := []interface{}{}
+			for _, attrs := range metrics {
+				symbols = append(symbols, map[string]interface{}{"attributes": attrs})
+			}
+			js, _ := json.Marshal(map[string]interface{}{"list_type": map[string]interface{}{"symbol": symbols}})
+			return string(js)
+		}
+		if strings.HasPrefix(statement, "delete ") {
+			delete(metrics, strings.TrimPrefix(statement, "delete "))
+			return `{"delete_metric": {"error": {"message": ""}}}`
+		}
+		parts := strings.SplitN(statement, " = ", 2)
+		if created := strings.TrimPrefix(parts[0], "metric "); len(parts) == 2 && created != parts[0] {
+			if metrics[created] != nil {
+				return `{"define_metric": {"error": {"message": "already exists"}}}`
+			}
+			metrics[created] = map[string]interface{}{"name": created, "val": strings.Trim(parts[1], "\"")}
+			return `{"define_metric": {"error": {"message": ""}}}`
+		}
+		field := strings.SplitN(parts[0], ".", 2)
+		if len(parts) == 2 && len(field) == 2 && metrics[field[0]] != nil {
+			if failing[parts[0]] {
+				return `{"update_metric": {"error": {"message": "invalid value"}}}`
+			}
+			metrics[field[0]][field[1]] = strings.Trim(parts[1], "\"")
+		}
+		return `{"update_metric": {"error": {"message": ""}}}`
+	})
+	return &ops
+}
+
+func TestOpPackRollback(t *testing.T) {
+	metrics := map[string]map[string]interface{}{
+		"m1": {"name": "m1", "val": "cpu_usage", "description": "v1"},
+		"m2": {"name": "m2", "val": "mem_usage", "description": "v1"},
+	}
+	ops := fakeMetricBackend(t, metrics, map[string]bool{"m2.description": true})
+
+	p := &opPackInstaller{configJsStr: ObjectConfigJsonStr, resources: map[string]*schema.Resource{"metric": resourceShorelineObject(ObjectConfigJsonStr, "metric")}}
+	version := func(v string) []opPackObject {
+		return []opPackObject{
+			{Type: "metric", Name: "m1", Attributes: map[string]interface{}{"value": "cpu_usage", "description": v}, Hash: "m1" + v},
+			{Type: "metric", Name: "m2", Attributes: map[string]interface{}{"value": "mem_usage", "description": v}, Hash: "m2" + v},
+		}
+	}
+
+	// m1 is updated, then m2 fails, so m1 is put back
+	diags := p.install(context.Background(), &apiClient{}, "p1", version("v1"), version("v2"))
+	if !diags.HasError() {
+		t.Fatalf("expected the install to fail, ops: %v\n", *ops)
+	}
+	if metrics["m1"]["description"] != "v1" || metrics["m2"]["description"] != "v1" {
+		t.Fatalf("expected the previous version after the rollback, got: %v (ops: %v)\n", metrics, *ops)
+	}
+	updated := false
+	for _, op := range *ops {
+		updated = updated || op == `m1.description = "v2"`
+	}
+	if !updated {
+		t.Fatalf("expected m1 to be updated before the failure, ops: %v\n", *ops)
+	}
+
+	// m3 is created, then m4's name is taken by an object the pack doesn't own, which must survive
+	metrics["m4"] = map[string]interface{}{"name": "m4", "val": "disk_usage", "description": "not the pack's"}
+	*ops = []string{}
+	diags = p.install(context.Background(), &apiClient{}, "p1", nil, []opPackObject{
+		{Type: "metric", Name: "m3", Attributes: map[string]interface{}{"value": "net_usage"}, Hash: "m3"},
+		{Type: "metric", Name: "m4", Attributes: map[string]interface{}{"value": "io_usage"}, Hash: "m4"},
+	})
+	if !diags.HasError() {
+		t.Fatalf("expected the install to fail, ops: %v\n", *ops)
+	}
+	if metrics["m3"] != nil || metrics["m4"] == nil || metrics["m4"]["val"] != "disk_usage" {
+		t.Fatalf("expected m3 to be rolled back and m4 to be left alone, got: %v (ops: %v)\n", metrics, *ops)
+	}
+	for _, d := range diags {
+		if strings.Contains(d.Summary, "Failed to roll back") {
+			t.Fatalf("unexpected rollback failure: %v\n", diags)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Readiness checks, from the object-level "ready" entry of an object definition, e.g.:
+//   "ready": {
+//     "op":          "<op statement>",  -- op to poll, with ${<attribute>} substituted
+//     "path":        "<json path>",     -- the value (or list of values) to check
+//     "item":        "checksum",  -- when "path" is a list: the field of each item to check (all must match,
+//                                    and an empty list is still pending)
+//     "expect":      true,        -- the expected value
+//     "expect_attr": "checksum",  -- or: expect the value of an attribute of the object
+//     "if_attr":     "enabled"    -- only check when this attribute is set (e.g. disabled objects never get ready)
+//   }
+// When the provider's "wait_for_ready" is set, create/update poll the check (with backoff)
+// until it passes, or the create/update timeout expires.
+// The embedded definitions (ObjectConfigJsonStr) check that files are distributed to all their
+// resources with the expected checksum, that alarms are compiled, and that bots are active.
+
+// Metadata keys understood in "ready", and the JSON kind of their value.
+var objectReadyVocabulary = map[string]string{
+	"op":          "string",
+	"path":        "string",
+	"item":        "string",
+	"expect":      "any",
+	"expect_attr": "string",
+	"if_attr":     "string",
+}
+
+const readyTimeoutDefault = 10 * time.Minute
+const pollIntervalMin = 1 * time.Second
+const pollIntervalMax = 30 * time.Second
+
+// Waits for the poll interval (unless cancelled), and returns the next (backed off) interval.
+func pollBackoff(ctx context.Context, wait time.Duration) (time.Duration, bool) {
+	select {
+	case <-ctx.Done():
+		return wait, true
+	case <-time.After(wait):
+	}
+	wait *= 2
+	if wait > pollIntervalMax {
+		wait = pollIntervalMax
+	}
+	return wait, false
+}
+
+func validateReadyCheck(typ string, ready interface{}, attributes map[string]interface{}) error {
+	readyMap, isMap := ready.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("Object definition '%s' ready is not an object", typ)
+	}
+	for meta, val := range readyMap {
+		kind, known := objectReadyVocabulary[meta]
+		if !known {
+			return fmt.Errorf("Object definition '%s' ready has unknown metadata '%s'", typ, meta)
+		}
+		if !validateAttrMetaKind(kind, val) {
+			return fmt.Errorf("Object definition '%s' ready metadata '%s' should be a %s, got: %v", typ, meta, kind, val)
+		}
+	}
+	for _, req := range []string{"op", "path"} {
+		if _, exists := readyMap[req]; !exists {
+			return fmt.Errorf("Object definition '%s' ready is missing '%s'", typ, req)
+		}
+	}
+	for _, attrKey := range []string{"expect_attr", "if_attr"} {
+		attr, isStr := readyMap[attrKey].(string)
+		if _, exists := attributes[attr]; isStr && !exists {
+			return fmt.Errorf("Object definition '%s' ready %s refers to unknown attribute '%s'", typ, attrKey, attr)
+		}
+	}
+	return nil
+}
+
+// Expands ${<attribute>} in the check's op statement.
+func readyCheckOp(check map[string]interface{}, getAttr func(string) interface{}) string {
+	op := CastToString(check["op"])
+	re := regexp.MustCompile(`\$\{\w\w*\}`)
+	return re.ReplaceAllStringFunc(op, func(expr string) string {
+		return CastToString(getAttr(expr[2 : len(expr)-1]))
+	})
+}
+
+func readyValueMatches(val interface{}, expect interface{}) bool {
+	if val == nil {
+		return false
+	}
+	switch expect.(type) {
+	case bool:
+		b, ok := CastToBoolMaybe(val)
+		return ok && b == expect.(bool)
+	case float64, int:
+		return CastToNumber(val) == CastToNumber(expect)
+	}
+	return CastToString(val) == CastToString(expect)
+}
+
+// Evaluates a readiness check against the result of its op.
+// Returns whether it passed, and a description of what's still pending.
+func EvalReadyCheck(check map[string]interface{}, result map[string]interface{}, expect interface{}) (bool, string) {
+	path := CastToString(check["path"])
+	val := GetNestedValueOrDefault(result, ToKeyPath(path), nil)
+	item, hasItem := check["item"].(string)
+	if !hasItem {
+		if readyValueMatches(val, expect) {
+			return true, ""
+		}
+		return false, fmt.Sprintf("%s is '%v', waiting for '%v'", path, val, expect)
+	}
+
+	items, isList := val.([]interface{})
+	if !isList {
+		return false, fmt.Sprintf("%s is not available yet", path)
+	}
+	if len(items) == 0 {
+		// e.g. not reported by any resource yet
+		return false, fmt.Sprintf("%s is empty", path)
+	}
+	pending := 0
+	for _, it := range items {
+		if !readyValueMatches(GetNestedValueOrDefault(it, ToKeyPath(item), nil), expect) {
+			pending += 1
+		}
+	}
+	if pending > 0 {
+		return false, fmt.Sprintf("%d of %d %s.%s are not '%v' yet", pending, len(items), path, item, expect)
+	}
+	return true, ""
+}
+
+// Polls the object's readiness check (if any) until it passes or times out.
+func waitForShorelineObjectReady(ctx context.Context, typ string, check map[string]interface{}, d *schema.ResourceData, timeout time.Duration) diag.Diagnostics {
+	if !WaitForReady || check == nil {
+		return nil
+	}
+	name := d.Get("name").(string)
+	ifAttr, hasIf := check["if_attr"].(string)
+	if hasIf && !ForceToBool(d.Get(ifAttr)) {
+		appendActionLog(fmt.Sprintf("Ready check (skipped, %s not set) %s: '%s'\n", ifAttr, typ, name))
+		return nil
+	}
+	getAttr := func(key string) interface{} {
+		if key == "name" {
+			return name
+		}
+		return d.Get(key)
+	}
+	op := readyCheckOp(check, getAttr)
+	expect := check["expect"]
+	expectAttr, hasExpectAttr := check["expect_attr"].(string)
+	if hasExpectAttr {
+		expect = d.Get(expectAttr)
+	}
+
+	deadline := time.Now().Add(timeout)
+	wait := pollIntervalMin
+	for {
+		js, err := runOpCommandToJson(op)
+		if err != nil {
+			return diag.Errorf("Failed to check readiness of %s '%s': %s", typ, name, err.Error())
+		}
+		ready, pending := EvalReadyCheck(check, js, expect)
+		if ready {
+			appendActionLog(fmt.Sprintf("Ready check (passed) %s: '%s'\n", typ, name))
+			return nil
+		}
+		appendActionLog(fmt.Sprintf("Ready check (pending) %s: '%s' :: %s\n", typ, name, pending))
+
+		if time.Now().Add(wait).After(deadline) {
+			return diag.Errorf("Timed out after %s waiting for %s '%s' to be ready: %s", timeout, typ, name, pending)
+		}
+		var cancelled bool
+		wait, cancelled = pollBackoff(ctx, wait)
+		if cancelled {
+			return diag.Errorf("Cancelled waiting for %s '%s' to be ready: %s", typ, name, pending)
+		}
+	}
+}
+
+// Resource timeouts: for deletes (see deleteShorelineObjectWithRefs), and for create/update,
+// which wait for readiness checks.
+func resourceShorelineObjectTimeouts() *schema.ResourceTimeout {
+	return &schema.ResourceTimeout{
+		Create: schema.DefaultTimeout(readyTimeoutDefault),
+		Update: schema.DefaultTimeout(readyTimeoutDefault),
+		Delete: schema.DefaultTimeout(deleteTimeoutDefault),
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Checks of the objects referenced by list attributes with "check_refs" (e.g. the actions in
+// an action sequence's steps, or a metric set's metrics), before they are written. This runs at apply time, so that objects
+// created earlier in the same run are found.
+
+// The names of the objects referenced by a list attribute value.
+func ReferencedObjectNames(val interface{}) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, v := range CastToArray(val) {
+		name := listItemObjectName(v)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns an error listing the referenced objects that don't exist.
+func checkShorelineObjectReferences(meta interface{}, typ string, attrs map[string]interface{}, d *schema.ResourceData, doDiff bool) diag.Diagnostics {
+	keys := []string{}
+	for key, _ := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !GetNestedValueOrDefault(attrs, ToKeyPath(key+".check_refs"), false).(bool) {
+			continue
+		}
+		if doDiff && !d.HasChange(key) {
+			continue
+		}
+		refs, _ := GetNestedValueOrDefault(attrs, ToKeyPath(key+".refs"), nil).(map[string]interface{})
+		refTypes := []string{}
+		for refTyp, _ := range refs {
+			refTypes = append(refTypes, refTyp)
+		}
+		sort.Strings(refTypes)
+
+		missing := []string{}
+		for _, name := range ReferencedObjectNames(d.Get(key)) {
+			found := false
+			for _, refTyp := range refTypes {
+				if _, _, diags := readShorelineObjectRecord(meta, refTyp, name); diags == nil {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return diag.Errorf("%s %s references unknown %s: %s", typ, key, strings.Join(refTypes, " or "), strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Renames of objects, applied as an update rather than a destroy/recreate.
+//
+// When the object definition has a "rename" entry (and the backend is new enough), its op is used:
+//   "rename": { "op": "rename ${old} to ${new}", "min_ver": "X.Y.Z" }
+// Otherwise the rename is a copy-then-swap: the new object is created from the configuration,
+// the objects that reference the old one (see the "refs" attribute metadata) are pointed at
+// the new one, then the old object is deleted.
+// A copy loses the object's history (e.g. action runs, alarm firings), and some objects can't
+// coexist with a copy (e.g. principals of the same identity). Such types keep "forcenew" on
+// their name, so they're replaced unless the backend can rename them in place.
+
+// Metadata keys understood in "rename", and the JSON kind of their value.
+var objectRenameVocabulary = map[string]string{
+	"op":      "string",
+	"min_ver": "string",
+}
+
+func validateRenameOp(typ string, rename interface{}) error {
+	renameMap, isMap := rename.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("Object definition '%s' rename is not an object", typ)
+	}
+	for meta, val := range renameMap {
+		kind, known := objectRenameVocabulary[meta]
+		if !known {
+			return fmt.Errorf("Object definition '%s' rename has unknown metadata '%s'", typ, meta)
+		}
+		if !validateAttrMetaKind(kind, val) {
+			return fmt.Errorf("Object definition '%s' rename metadata '%s' should be a %s, got: %v", typ, meta, kind, val)
+		}
+	}
+	op, _ := renameMap["op"].(string)
+	if !strings.Contains(op, "${old}") || !strings.Contains(op, "${new}") {
+		return fmt.Errorf("Object definition '%s' rename op should contain ${old} and ${new}, got: '%s'", typ, op)
+	}
+	minVer, isStr := renameMap["min_ver"].(string)
+	if isStr && !ParseVersionString(minVer).Valid {
+		return fmt.Errorf("Object definition '%s' rename has invalid min_ver '%s'", typ, minVer)
+	}
+	return nil
+}
+
+// The in-place rename op for a backend version, or "" if renames have to copy-then-swap.
+// An unknown backend version is treated as the newest one.
+func renameOpForVersion(rename map[string]interface{}, ver VersionRecord, old string, nu string) string {
+	op, isStr := rename["op"].(string)
+	if !isStr || op == "" {
+		return ""
+	}
+	minVer, hasMin := rename["min_ver"].(string)
+	if hasMin && minVer != "" {
+		gtlteq, valid := CompareVersionRecords(ver, ParseVersionString(minVer))
+		if valid && gtlteq < 0 {
+			return ""
+		}
+	}
+	return strings.NewReplacer("${old}", old, "${new}", nu).Replace(op)
+}
+
+// Points references to an object (see ReferencesObject()) at its new name.
+func ReplaceObjectReference(val interface{}, old string, nu string) interface{} {
+	switch val.(type) {
+	case string:
+		re := regexp.MustCompile(`(^|[^a-zA-Z0-9_])` + regexp.QuoteMeta(old) + `([^a-zA-Z0-9_]|$)`)
+		// repeated, as adjacent references share a separator
+		out := val.(string)
+		for re.MatchString(out) {
+			out = re.ReplaceAllString(out, "${1}"+nu+"${2}")
+		}
+		return out
+	case []interface{}:
+		out := []interface{}{}
+		for _, v := range val.([]interface{}) {
+			if listItemObjectName(v) == old {
+				v = nu + CastToString(v)[len(old):]
+			}
+			out = append(out, v)
+		}
+		return out
+	}
+	return val
+}
+
+func renameNote(old string, nu string, inPlace bool) string {
+	if inPlace {
+		return fmt.Sprintf("'%s' renamed in place to '%s'", old, nu)
+	}
+	return fmt.Sprintf("'%s' copied to '%s', referencing objects updated, then '%s' deleted", old, nu, old)
+}
+
+// Checks service params (see resourceShorelineObjectServicesDiff()), plans changes of files'
+// source_dir (see resourceShorelineFileDiff()), and shows how a change of name will be
+// applied in the plan (through "rename_note"), or replaces the object if it can't be copied.
+func resourceShorelineObjectDiff(typ string, attrs map[string]interface{}, object interface{}, rename map[string]interface{}, copyUnsafe bool) schema.CustomizeDiffFunc {
+	return func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+		if err := resourceShorelineObjectServicesDiff(typ, attrs, object, d); err != nil {
+			return err
+		}
+		if typ == "file" {
+			if err := resourceShorelineFileDiff(d); err != nil {
+				return err
+			}
+		}
+		if d.Id() == "" || !d.HasChange("name") || (copyUnsafe && rename == nil) {
+			return nil
+		}
+		if !d.NewValueKnown("name") {
+			return d.SetNewComputed("rename_note")
+		}
+		old, nu := d.GetChange("name")
+		client, _ := meta.(*apiClient)
+		op := renameOpForVersion(rename, client.BackendVersion(), old.(string), nu.(string))
+		if op == "" && copyUnsafe {
+			return d.ForceNew("name")
+		}
+		return d.SetNew("rename_note", renameNote(old.(string), nu.(string), op != ""))
+	}
+}
+
+// Points the objects that reference 'old' at 'nu', keeping their enabled state.
+func updateShorelineObjectReferences(meta interface{}, typ string, old string, nu string, referrers []objectReferrer) diag.Diagnostics {
+	refs, err := findShorelineObjectReferences(meta, typ, old, referrers)
+	if err != nil {
+		return diag.Errorf("Failed to find objects referencing %s '%s': %s", typ, old, err.Error())
+	}
+	for _, ref := range refs {
+		appendActionLog(fmt.Sprintf("Rename of '%s' to '%s': updating %s '%s' (%s)\n", old, nu, ref.typ, ref.name, ref.key))
+		diags := setFieldKeepEnabled(meta, ref.typ, ref.attrs, ref.name, ref.key, ReplaceObjectReference(ref.val, old, nu))
+		if diags != nil {
+			return diags
+		}
+	}
+	return nil
+}
+
+// Sets a field of an object that isn't managed by this resource, re-enabling it
+// if it was enabled (as OpLang disables objects on any change).
+func setFieldKeepEnabled(meta interface{}, typ string, attrs map[string]interface{}, name string, key string, val interface{}) diag.Diagnostics {
+	wasEnabled := false
+	if _, canEnable := attrs["enabled"]; canEnable {
+		record, stepsJs, diags := readShorelineObjectRecord(meta, typ, name)
+		if diags != nil {
+			return diags
+		}
+		_, enabled, _ := resourceShorelineObjectReadSingleAttr(name, typ, "enabled", attrs, record, stepsJs, nil)
+		wasEnabled = ForceToBool(enabled)
+	}
+	invalidateCachedObject(meta, typ, name)
+	diags := setFieldViaOp(typ, attrs, name, key, val)
+	if diags != nil {
+		return diags
+	}
+	if wasEnabled {
+		return setObjectEnabled(typ, name, true)
+	}
+	return nil
+}
+
+// Renames an object from its prior name to the configured one.
+// Returns whether the object was re-created (so all of its fields are already set).
+func renameShorelineObject(ctx context.Context, d *schema.ResourceData, meta interface{}, typ string, primary string, attrs map[string]interface{}, rename map[string]interface{}, referrers []objectReferrer) (bool, diag.Diagnostics) {
+	oldVal, nuVal := d.GetChange("name")
+	old, nu := oldVal.(string), nuVal.(string)
+	client, _ := meta.(*apiClient)
+	invalidateCachedObject(meta, typ, old)
+	invalidateCachedObject(meta, typ, nu)
+
+	op := renameOpForVersion(rename, client.BackendVersion(), old, nu)
+	if op != "" {
+		appendActionLog(fmt.Sprintf("Renaming %s: '%s' to '%s' Op:'%s'\n", typ, old, nu, op))
+		result, err := runOpCommand(op, true)
+		if err == nil {
+			err = CheckUpdateResult(result)
+		}
+		if err != nil {
+			d.Partial(true)
+			return false, diag.Errorf("Failed to rename %s '%s' to '%s': %s", typ, old, nu, err.Error())
+		}
+		d.SetId(nu)
+		return false, nil
+	}
+
+	appendActionLog(fmt.Sprintf("Renaming %s: '%s' to '%s' (copy-then-swap)\n", typ, old, nu))
+	diags := createShorelineObject(ctx, d, meta, typ, primary, attrs)
+	if diags != nil {
+		d.Partial(true)
+		return false, diags
+	}
+	diags = updateShorelineObjectReferences(meta, typ, old, nu, referrers)
+	if diags != nil {
+		// point any updated objects back, and drop the copy
+		diags = append(diags, updateShorelineObjectReferences(meta, typ, nu, old, referrers)...)
+		deleteShorelineObject(typ, nu)
+		d.Partial(true)
+		return false, diags
+	}
+	d.SetId(nu)
+
+	err := deleteShorelineObject(typ, old)
+	if err != nil {
+		return true, diag.Diagnostics{diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Renamed %s '%s' to '%s', but failed to delete '%s' (it may need to be deleted manually).", typ, old, nu, old),
+			Detail:   err.Error(),
+		}}
+	}
+	return true, nil
+}
@@ -0,0 +1,490 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// One-off runs, started on create (or when their "triggers" change) and polled until done.
+//
+// shoreline_action_run runs an action against a resource query, as a job:
+//   run_action( action_name = "<action>", resource_query = "<query>", params = "<JSON>" )  -> run_action.job_id
+//   get_action_job( job_id = "<id>" )  -> get_action_job.status, get_action_job.resources[].{resource_name, exit_status, stdout}
+// shoreline_notebook_run runs a notebook with parameter values:
+//   run_notebook( notebook_name = "<notebook>", params = "<JSON>" )  -> run_notebook.run_id
+//   get_notebook_run( run_id = "<id>" )  -> get_notebook_run.status, .approvers, .cells[].{status, output}
+//   cancel_notebook_run( run_id = "<id>" )
+// Runs of notebooks with approvers wait for approval, which can't be given from Terraform, so
+// these fail the apply: before starting when the notebook has approvers, or (if they were added
+// meanwhile) once the run waits for approval, which is then cancelled rather than left pending.
+// Nothing is undone on destroy: the run is just dropped from the state.
+
+// Job statuses that are final (anything else is still running).
+var runDoneStatuses = map[string]bool{
+	"completed": true,
+	"succeeded": true,
+	"failed":    true,
+	"cancelled": true,
+	"canceled":  true,
+	"timed_out": true,
+}
+
+func runIsDone(status string) bool {
+	return runDoneStatuses[strings.ToLower(status)]
+}
+
+// Whether a (final) status means success.
+func runSucceeded(status string) bool {
+	s := strings.ToLower(status)
+	return s == "completed" || s == "succeeded"
+}
+
+// Run statuses that wait for an approver.
+var runApprovalStatuses = map[string]bool{
+	"pending_approval":     true,
+	"waiting_for_approval": true,
+	"awaiting_approval":    true,
+}
+
+func runNeedsApproval(status string) bool {
+	return runApprovalStatuses[strings.ToLower(status)]
+}
+
+// The exit status recorded for a resource the backend reported none for (counted as a failure,
+// as the action can't be known to have succeeded there).
+const exitStatusUnknown = -1
+
+// The op to start an action job.
+func actionRunOp(action string, query string, params map[string]interface{}) (string, error) {
+	js, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("run_action( action_name = \"%s\", resource_query = \"%s\", params = \"%s\" )", action, EscapeString(query), EscapeString(string(js))), nil
+}
+
+// The status of an action job, its per-resource results (sorted by resource), and how many resources failed.
+func ParseActionJob(js map[string]interface{}) (string, []interface{}, int) {
+	status := CastToString(GetNestedValueOrDefault(js, ToKeyPath("get_action_job.status"), ""))
+	resources, _ := GetNestedValueOrDefault(js, ToKeyPath("get_action_job.resources"), []interface{}{}).([]interface{})
+	results := []interface{}{}
+	failed := 0
+	for _, r := range resources {
+		exitStatus := exitStatusUnknown
+		if raw := GetNestedValueOrDefault(r, ToKeyPath("exit_status"), nil); raw != nil {
+			exitStatus = int(CastToNumber(raw))
+		}
+		if exitStatus != 0 {
+			failed += 1
+		}
+		results = append(results, map[string]interface{}{
+			"resource_name": CastToString(GetNestedValueOrDefault(r, ToKeyPath("resource_name"), "")),
+			"exit_status":   exitStatus,
+			"stdout":        CastToString(GetNestedValueOrDefault(r, ToKeyPath("stdout"), "")),
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].(map[string]interface{})["resource_name"].(string) < results[j].(map[string]interface{})["resource_name"].(string)
+	})
+	return status, results, failed
+}
+
+// Polls a run's op until 'done' reports it finished, or the timeout expires.
+func pollRun(ctx context.Context, what string, op string, timeout time.Duration, done func(map[string]interface{}) (bool, string)) (map[string]interface{}, diag.Diagnostics) {
+	deadline := time.Now().Add(timeout)
+	wait := pollIntervalMin
+	for {
+		js, err := runOpCommandToJson(op)
+		if err != nil {
+			return nil, diag.Errorf("Failed to check %s: %s", what, err.Error())
+		}
+		finished, status := done(js)
+		if finished {
+			appendActionLog(fmt.Sprintf("Run (finished) %s: %s\n", what, status))
+			return js, nil
+		}
+		appendActionLog(fmt.Sprintf("Run (pending) %s: %s\n", what, status))
+
+		if time.Now().Add(wait).After(deadline) {
+			return nil, diag.Errorf("Timed out after %s waiting for %s, last status: '%s'", timeout, what, status)
+		}
+		var cancelled bool
+		wait, cancelled = pollBackoff(ctx, wait)
+		if cancelled {
+			return nil, diag.Errorf("Cancelled waiting for %s, last status: '%s'", what, status)
+		}
+	}
+}
+
+// Changing any of these starts a new run.
+func runTriggersSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeMap,
+		Optional:    true,
+		ForceNew:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "Arbitrary values that start a new run when changed (e.g. a version or a hash of deployed files).",
+	}
+}
+
+func resourceShorelineActionRun() *schema.Resource {
+	return &schema.Resource{
+		Description: "Shoreline action run. Runs an action once, as part of an apply, and waits for it to complete.\n\n" +
+			"A new run is started when any of the arguments (including `triggers`) change. Destroying the resource doesn't undo anything.",
+
+		CreateContext: resourceShorelineActionRunCreate,
+		ReadContext:   resourceShorelineRunNoop,
+		UpdateContext: resourceShorelineRunNoop,
+		DeleteContext: resourceShorelineRunDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(readyTimeoutDefault),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"action_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					if !ValidateVariableName(val.(string)) {
+						errs = append(errs, fmt.Errorf("%q must be a valid action name (^[_a-zA-Z][_a-zA-Z0-9]*$),\n but got: %s", key, val.(string)))
+					}
+					return
+				},
+				Description: "The name of the action to run.",
+			},
+			"params": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Values for the action's parameters.",
+			},
+			"resource_query": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The resources to run the action on.",
+			},
+			"triggers": runTriggersSchema(),
+			"fail_on_error": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Fail the apply if the action job doesn't succeed, or the action fails on any resource (the run is then retried on the next apply).",
+			},
+			"job_id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The ID of the action job.",
+			},
+			"status": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The final status of the action job.",
+			},
+			"failed_count": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The number of resources the action failed on.",
+			},
+			"results": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The outcome on each resource.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"resource_name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The resource the action ran on.",
+						},
+						"exit_status": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "The exit status of the action on the resource, or -1 if the backend didn't report one (counted as a failure).",
+						},
+						"stdout": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The output of the action on the resource.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func resourceShorelineActionRunCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	action := d.Get("action_name").(string)
+	params, _ := d.Get("params").(map[string]interface{})
+	op, err := actionRunOp(action, d.Get("resource_query").(string), params)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	appendActionLog(fmt.Sprintf("Running action '%s' Op:'%s'\n", action, op))
+	js, err := runOpCommandToJson(op)
+	if err != nil {
+		return diag.Errorf("Failed to run action '%s': %s", action, err.Error())
+	}
+	jobId := CastToString(GetNestedValueOrDefault(js, ToKeyPath("run_action.job_id"), ""))
+	if jobId == "" {
+		return diag.Errorf("Failed to run action '%s': no job ID in the response", action)
+	}
+
+	what := fmt.Sprintf("action '%s' job '%s'", action, jobId)
+	pollOp := fmt.Sprintf("get_action_job( job_id = \"%s\" )", jobId)
+	js, diags := pollRun(ctx, what, pollOp, d.Timeout(schema.TimeoutCreate), func(js map[string]interface{}) (bool, string) {
+		status, _, _ := ParseActionJob(js)
+		return runIsDone(status), status
+	})
+	if diags != nil {
+		return diags
+	}
+	status, results, failed := ParseActionJob(js)
+	if failure := describeActionRunFailure(status, results); failure != "" && d.Get("fail_on_error").(bool) {
+		return diag.Errorf("Action '%s' (job '%s') %s", action, jobId, failure)
+	}
+
+	d.SetId(jobId)
+	d.Set("job_id", jobId)
+	d.Set("status", status)
+	d.Set("failed_count", failed)
+	d.Set("results", results)
+	return nil
+}
+
+// Why an action job failed, or "" if it succeeded on every resource. A job can fail
+// (or be cancelled, or time out) without any per-resource results.
+func describeActionRunFailure(status string, results []interface{}) string {
+	failures := []string{}
+	for _, r := range results {
+		res := r.(map[string]interface{})
+		switch res["exit_status"].(int) {
+		case 0:
+		case exitStatusUnknown:
+			failures = append(failures, fmt.Sprintf("%s (no exit status)", res["resource_name"]))
+		default:
+			failures = append(failures, fmt.Sprintf("%s (exit status %d)", res["resource_name"], res["exit_status"]))
+		}
+	}
+	reasons := []string{}
+	if !runSucceeded(status) {
+		reasons = append(reasons, fmt.Sprintf("finished with status '%s'", status))
+	}
+	if len(failures) > 0 {
+		reasons = append(reasons, fmt.Sprintf("failed on %d of %d resources: %s", len(failures), len(results), strings.Join(failures, ", ")))
+	}
+	return strings.Join(reasons, ", and ")
+}
+
+// Runs are one-off, so there's nothing to refresh or change in place.
+func resourceShorelineRunNoop(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return nil
+}
+
+func resourceShorelineRunDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	appendActionLog(fmt.Sprintf("Dropping run '%s' from the state\n", d.Id()))
+	d.SetId("")
+	return nil
+}
+
+// The op to start a notebook run.
+func notebookRunOp(notebook string, params map[string]interface{}) (string, error) {
+	js, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("run_notebook( notebook_name = \"%s\", params = \"%s\" )", notebook, EscapeString(string(js))), nil
+}
+
+// The approvers of a notebook (sorted), read fresh from the backend.
+func notebookApprovers(meta interface{}, attrs map[string]interface{}, notebook string) ([]string, diag.Diagnostics) {
+	invalidateCachedObject(meta, "notebook", notebook)
+	record, stepsJs, diags := readShorelineObjectRecord(meta, "notebook", notebook)
+	if diags != nil {
+		return nil, diags
+	}
+	_, val, diags := resourceShorelineObjectReadSingleAttr(notebook, "notebook", "approvers", attrs, record, stepsJs, nil)
+	if diags != nil {
+		return nil, diags
+	}
+	approvers := []string{}
+	for _, a := range CastToArray(val) {
+		approvers = append(approvers, CastToString(a))
+	}
+	sort.Strings(approvers)
+	return approvers, nil
+}
+
+// The status of a notebook run, its approvers, and the outcome of each cell (in notebook order).
+func ParseNotebookRun(js map[string]interface{}) (string, []string, []interface{}) {
+	status := CastToString(GetNestedValueOrDefault(js, ToKeyPath("get_notebook_run.status"), ""))
+	approvers := []string{}
+	for _, a := range CastToArray(GetNestedValueOrDefault(js, ToKeyPath("get_notebook_run.approvers"), []interface{}{})) {
+		approvers = append(approvers, CastToString(a))
+	}
+	sort.Strings(approvers)
+	cells := []interface{}{}
+	for i, c := range CastToArray(GetNestedValueOrDefault(js, ToKeyPath("get_notebook_run.cells"), []interface{}{})) {
+		cells = append(cells, map[string]interface{}{
+			"index":  i,
+			"status": CastToString(GetNestedValueOrDefault(c, ToKeyPath("status"), "")),
+			"output": CastToString(GetNestedValueOrDefault(c, ToKeyPath("output"), "")),
+		})
+	}
+	return status, approvers, cells
+}
+
+func resourceShorelineNotebookRun(configJsStr string) *schema.Resource {
+	objects := map[string]interface{}{}
+	json.Unmarshal([]byte(configJsStr), &objects)
+	notebookAttrs, _ := GetNestedValueOrDefault(objects, ToKeyPath("notebook.attributes"), map[string]interface{}{}).(map[string]interface{})
+
+	return &schema.Resource{
+		Description: "Shoreline notebook run. Runs a notebook once, as part of an apply, and waits for it to complete.\n\n" +
+			"A new run is started when any of the arguments (including `triggers`) change. " +
+			"Notebooks that have `approvers` can't be run, as runs can't be approved from Terraform: this fails before starting the run " +
+			"(or, if approvers were added meanwhile, cancels the run once it waits for approval). " +
+			"Destroying the resource doesn't undo anything.",
+
+		CreateContext: resourceShorelineNotebookRunCreate(notebookAttrs),
+		ReadContext:   resourceShorelineRunNoop,
+		UpdateContext: resourceShorelineRunNoop,
+		DeleteContext: resourceShorelineRunDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(readyTimeoutDefault),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"notebook_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateFunc: func(val interface{}, key string) (warns []string, errs []error) {
+					if !ValidateVariableName(val.(string)) {
+						errs = append(errs, fmt.Errorf("%q must be a valid notebook name (^[_a-zA-Z][_a-zA-Z0-9]*$),\n but got: %s", key, val.(string)))
+					}
+					return
+				},
+				Description: "The name of the notebook to run.",
+			},
+			"params": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Values for the notebook's parameters.",
+			},
+			"triggers": runTriggersSchema(),
+			"fail_on_error": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Fail the apply if the run doesn't complete successfully (the run is then retried on the next apply).",
+			},
+			"run_id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The ID of the notebook run.",
+			},
+			"status": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The final status of the notebook run.",
+			},
+			"cells": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The outcome of each cell, in notebook order.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"index": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "The position of the cell in the notebook (from 0).",
+						},
+						"status": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The status of the cell.",
+						},
+						"output": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The output of the cell.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func resourceShorelineNotebookRunCreate(notebookAttrs map[string]interface{}) schema.CreateContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+		notebook := d.Get("notebook_name").(string)
+		params, _ := d.Get("params").(map[string]interface{})
+		op, err := notebookRunOp(notebook, params)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		approvers, diags := notebookApprovers(meta, notebookAttrs, notebook)
+		if diags != nil {
+			return diags
+		}
+		if len(approvers) > 0 {
+			return diag.Errorf("Notebook '%s' requires approval (approvers: %s), which can't be given from Terraform, so it wasn't run. Run it in Shoreline, or run a notebook without approvers.", notebook, strings.Join(approvers, ", "))
+		}
+
+		appendActionLog(fmt.Sprintf("Running notebook '%s' Op:'%s'\n", notebook, op))
+		js, err := runOpCommandToJson(op)
+		if err != nil {
+			return diag.Errorf("Failed to run notebook '%s': %s", notebook, err.Error())
+		}
+		runId := CastToString(GetNestedValueOrDefault(js, ToKeyPath("run_notebook.run_id"), ""))
+		if runId == "" {
+			return diag.Errorf("Failed to run notebook '%s': no run ID in the response", notebook)
+		}
+
+		what := fmt.Sprintf("notebook '%s' run '%s'", notebook, runId)
+		pollOp := fmt.Sprintf("get_notebook_run( run_id = \"%s\" )", runId)
+		js, diags = pollRun(ctx, what, pollOp, d.Timeout(schema.TimeoutCreate), func(js map[string]interface{}) (bool, string) {
+			status, _, _ := ParseNotebookRun(js)
+			return runIsDone(status) || runNeedsApproval(status), status
+		})
+		if diags != nil {
+			return diags
+		}
+		status, approvers, cells := ParseNotebookRun(js)
+		if runNeedsApproval(status) {
+			// approvers were added since the check above
+			cancelOp := fmt.Sprintf("cancel_notebook_run( run_id = \"%s\" )", runId)
+			if _, err := runOpCommandToJson(cancelOp); err != nil {
+				return diag.Errorf("Notebook '%s' run '%s' requires approval (approvers: %s), and cancelling it failed: %s", notebook, runId, strings.Join(approvers, ", "), err.Error())
+			}
+			return diag.Errorf("Notebook '%s' run '%s' requires approval (approvers: %s), which can't be given from Terraform, so it was cancelled.", notebook, runId, strings.Join(approvers, ", "))
+		}
+		if !runSucceeded(status) && d.Get("fail_on_error").(bool) {
+			return diag.Errorf("Notebook '%s' run '%s' finished with status '%s'", notebook, runId, status)
+		}
+
+		d.SetId(runId)
+		d.Set("run_id", runId)
+		d.Set("status", status)
+		d.Set("cells", cells)
+		return nil
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Service-specific params (e.g. of integrations), packed into the object's "params" JSON.
+//
+// Attributes with "param" metadata are not set individually, but written together as
+// "<name>.params = <JSON>", keyed by the param name:
+//   "api_key": { "type": "string", "optional": true, "param": "api_key", "step": "params_unpack.api_key" }
+// The object-level "services" entry lists the params each service requires or allows,
+// keyed on the value of "service_attr" (checked at plan time):
+//   "service_attr": "service_name",
+//   "services": { "datadog": { "required": ["api_key", "app_key"], "optional": ["dashboard_name"] } }
+
+// The backend field that holds the packed params.
+const objectParamsField = "params"
+
+// The attributes that are packed into params, keyed by param name.
+func objectParamAttrs(attrs map[string]interface{}) map[string]string {
+	params := map[string]string{}
+	for key, _ := range attrs {
+		param, isStr := GetNestedValueOrDefault(attrs, ToKeyPath(key+".param"), nil).(string)
+		if isStr && param != "" {
+			params[param] = key
+		}
+	}
+	return params
+}
+
+// Packs attribute values into a params JSON string (skipping empty ones),
+// keeping any params of the 'base' JSON that aren't modeled as attributes.
+func PackObjectParams(attrs map[string]interface{}, vals map[string]interface{}, base string) (string, error) {
+	packed := map[string]interface{}{}
+	if base != "" {
+		err := json.Unmarshal([]byte(base), &packed)
+		if err != nil {
+			return "", err
+		}
+	}
+	for param, key := range objectParamAttrs(attrs) {
+		val, exists := vals[key]
+		if !exists || val == nil || val == "" {
+			delete(packed, param)
+			continue
+		}
+		packed[param] = val
+	}
+	js, err := json.Marshal(packed)
+	if err != nil {
+		return "", err
+	}
+	return string(js), nil
+}
+
+// Unpacks a params JSON string into attribute values.
+func UnpackObjectParams(attrs map[string]interface{}, paramsJs string) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	if paramsJs == "" {
+		return vals, nil
+	}
+	packed := map[string]interface{}{}
+	err := json.Unmarshal([]byte(paramsJs), &packed)
+	if err != nil {
+		return nil, err
+	}
+	for param, key := range objectParamAttrs(attrs) {
+		val, exists := packed[param]
+		if exists && val != nil {
+			vals[key] = val
+		}
+	}
+	return vals, nil
+}
+
+func validateObjectServices(typ string, object interface{}, attributes map[string]interface{}) error {
+	services, hasServices := GetNestedValueOrDefault(object, ToKeyPath("services"), nil).(map[string]interface{})
+	if !hasServices {
+		return nil
+	}
+	serviceAttr, isStr := GetNestedValueOrDefault(object, ToKeyPath("service_attr"), nil).(string)
+	if _, exists := attributes[serviceAttr]; !isStr || !exists {
+		return fmt.Errorf("Object definition '%s' services need a valid service_attr, got: %v", typ, serviceAttr)
+	}
+	params := objectParamAttrs(attributes)
+	for service, spec := range services {
+		for _, kind := range []string{"required", "optional"} {
+			list, isList := GetNestedValueOrDefault(spec, ToKeyPath(kind), []interface{}{}).([]interface{})
+			if !isList {
+				return fmt.Errorf("Object definition '%s' service '%s' %s is not a list", typ, service, kind)
+			}
+			for _, p := range list {
+				if _, known := params[CastToString(p)]; !known {
+					return fmt.Errorf("Object definition '%s' service '%s' has unknown param '%v'", typ, service, p)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Checks the params set for a service: the required ones are set, and none belong to other services.
+// 'isSet' reports if an attribute is set, and if that can be known (not e.g. for unchanged write-only attributes).
+func ValidateServiceParams(attrs map[string]interface{}, services map[string]interface{}, service string, isSet func(string) (bool, bool)) error {
+	spec, known := services[service]
+	if !known {
+		names := []string{}
+		for s, _ := range services {
+			names = append(names, s)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown service '%s', should be one of (%s)", service, strings.Join(names, ", "))
+	}
+	allowed := map[string]bool{}
+	for _, p := range GetNestedValueOrDefault(spec, ToKeyPath("optional"), []interface{}{}).([]interface{}) {
+		allowed[CastToString(p)] = true
+	}
+	paramAttrs := objectParamAttrs(attrs)
+	problems := []string{}
+	for _, p := range GetNestedValueOrDefault(spec, ToKeyPath("required"), []interface{}{}).([]interface{}) {
+		key := paramAttrs[CastToString(p)]
+		allowed[CastToString(p)] = true
+		set, knowable := isSet(key)
+		if knowable && !set {
+			problems = append(problems, fmt.Sprintf("%s is required", key))
+		}
+	}
+	for param, key := range paramAttrs {
+		if allowed[param] {
+			continue
+		}
+		if set, _ := isSet(key); set {
+			problems = append(problems, fmt.Sprintf("%s doesn't apply", key))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid params for service '%s': %s", service, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Plan-time check of the params of the configured service.
+func resourceShorelineObjectServicesDiff(typ string, attrs map[string]interface{}, object interface{}, d *schema.ResourceDiff) error {
+	services, hasServices := GetNestedValueOrDefault(object, ToKeyPath("services"), nil).(map[string]interface{})
+	if !hasServices {
+		return nil
+	}
+	serviceAttr := GetNestedValueOrDefault(object, ToKeyPath("service_attr"), "").(string)
+	if !d.NewValueKnown(serviceAttr) {
+		return nil
+	}
+	isSet := func(key string) (bool, bool) {
+		if !d.NewValueKnown(key) {
+			return true, false
+		}
+		if d.Id() != "" && GetNestedValueOrDefault(attrs, ToKeyPath(key+".write_only"), false).(bool) && !d.HasChange(key) {
+			// not stored in the state, so only known when sent
+			return false, false
+		}
+		val, _ := d.GetOk(key)
+		return val != nil && val != "", true
+	}
+	err := ValidateServiceParams(attrs, services, CastToString(d.Get(serviceAttr)), isSet)
+	if err != nil {
+		return fmt.Errorf("%s '%s' has %s", typ, d.Get("name"), err.Error())
+	}
+	return nil
+}
+
+// Reads the object's current params: the packed JSON, and its values by attribute.
+func readObjectParams(meta interface{}, typ string, attrs map[string]interface{}, name string) (string, map[string]interface{}, diag.Diagnostics) {
+	_, stepsJs, diags := readShorelineObjectRecord(meta, typ, name)
+	if diags != nil {
+		return "", nil, diags
+	}
+	current, _ := GetNestedValueOrDefault(stepsJs, ToKeyPath(objectParamsField), "").(string)
+	vals, err := UnpackObjectParams(attrs, current)
+	if err != nil {
+		return "", nil, diag.Errorf("Failed to unpack %s %s.%s: %s", typ, name, objectParamsField, err.Error())
+	}
+	return current, vals, nil
+}
+
+// Packs the values (by attribute) over the 'current' params JSON, and writes them.
+func writeObjectParams(typ string, attrs map[string]interface{}, name string, vals map[string]interface{}, current string) diag.Diagnostics {
+	packed, err := PackObjectParams(attrs, vals, current)
+	if err != nil {
+		return diag.Errorf("Failed to pack %s %s.%s: %s", typ, name, objectParamsField, err.Error())
+	}
+	paramsAttrs := map[string]interface{}{objectParamsField: map[string]interface{}{"type": "string"}}
+	return setFieldViaOp(typ, paramsAttrs, name, objectParamsField, packed)
+}
+
+// Writes the (changed) params, merged over the object's current ones.
+// Returns whether any were written, and marks their attributes in 'written' (if not nil).
+func setObjectParams(meta interface{}, typ string, attrs map[string]interface{}, name string, d *schema.ResourceData, doDiff bool, isCreate bool, written map[string]bool) (bool, diag.Diagnostics) {
+	paramAttrs := objectParamAttrs(attrs)
+	if len(paramAttrs) == 0 {
+		return false, nil
+	}
+	vals := map[string]interface{}{}
+	current := ""
+	if !isCreate {
+		var diags diag.Diagnostics
+		current, vals, diags = readObjectParams(meta, typ, attrs, name)
+		if diags != nil {
+			return false, diags
+		}
+	}
+	changed := []string{}
+	for _, key := range paramAttrs {
+		if doDiff && !d.HasChange(key) {
+			continue
+		}
+		val, exists := d.GetOk(key)
+		if !exists && !isCreate && !d.HasChange(key) {
+			continue
+		}
+		vals[key] = val
+		changed = append(changed, key)
+	}
+	if len(changed) == 0 {
+		return false, nil
+	}
+	if written != nil {
+		for _, key := range changed {
+			written[key] = true
+		}
+	}
+	return true, writeObjectParams(typ, attrs, name, vals, current)
+}
+
+// Rolls back the given param attributes to their 'snapshot' values (absent ones are removed),
+// keeping the object's other params.
+func restoreObjectParams(meta interface{}, typ string, attrs map[string]interface{}, name string, keys []string, snapshot map[string]interface{}) diag.Diagnostics {
+	current, vals, diags := readObjectParams(meta, typ, attrs, name)
+	if diags != nil {
+		return diags
+	}
+	for _, key := range keys {
+		vals[key] = snapshot[key]
+	}
+	appendActionLog(fmt.Sprintf("Rolling back %s params: '%s'.%v\n", typ, name, keys))
+	return writeObjectParams(typ, attrs, name, vals, current)
+}
@@ -0,0 +1,374 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Large file objects (on backends with presigned uploads) are uploaded in parts:
+//   start_file_upload( file_name = "<name>", size = <bytes>, part_size = <bytes>, upload_id = "<id>" )
+//     -> start_file_upload.{upload_id, parts[].{part_number, url}}
+//   complete_file_upload( file_name = "<name>", upload_id = "<id>", parts = "<JSON [{part_number, etag}]>" )
+//     -> complete_file_upload.md5 (of the stored object)
+// The upload_id is only passed to resume an upload, which gets fresh urls for its remaining parts.
+// Each part is retried on failure and checked against its ETag (the md5 of the part), and the
+// uploaded parts are saved locally, so a failed apply resumes where it stopped.
+// Backends without start_file_upload (see opMinVersions), and small files, get a single PUT to
+// "presigned_put", which is limited to uploadSinglePutMax.
+
+// The default size of the parts, and the smallest allowed (by S3).
+const uploadPartSizeDefault = 64 * 1024 * 1024
+const uploadPartSizeMin = 5 * 1024 * 1024
+
+// The largest single PUT (allowed by S3).
+const uploadSinglePutMax = 5 * 1024 * 1024 * 1024
+
+const startFileUploadOpName = "start_file_upload"
+
+// Attempts per part (or single PUT) before giving up.
+const uploadAttempts = 5
+
+// A part of a file: 1-based number, and byte range.
+type uploadPart struct {
+	Number int
+	Offset int64
+	Length int64
+}
+
+// The state of a multipart upload, saved after each part to resume it.
+type fileUpload struct {
+	Name     string         `json:"name"`
+	UploadId string         `json:"upload_id"`
+	Md5      string         `json:"md5"`
+	Size     int64          `json:"size"`
+	PartSize int64          `json:"part_size"`
+	Etags    map[int]string `json:"etags"`
+}
+
+// The part size, from SHORELINE_UPLOAD_PART_SIZE (in bytes) if set.
+func getUploadPartSize() int64 {
+	env, hasEnv := os.LookupEnv("SHORELINE_UPLOAD_PART_SIZE")
+	if !hasEnv || env == "" {
+		return uploadPartSizeDefault
+	}
+	size, err := strconv.ParseInt(env, 10, 64)
+	if err != nil || size < uploadPartSizeMin {
+		appendActionLog(fmt.Sprintf("Ignoring invalid SHORELINE_UPLOAD_PART_SIZE '%s' (at least %d bytes)\n", env, uploadPartSizeMin))
+		return uploadPartSizeDefault
+	}
+	return size
+}
+
+// Splits 'size' bytes into parts of 'partSize' (the last one may be shorter).
+func UploadParts(size int64, partSize int64) []uploadPart {
+	parts := []uploadPart{}
+	for offset := int64(0); offset < size; offset += partSize {
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		parts = append(parts, uploadPart{Number: len(parts) + 1, Offset: offset, Length: length})
+	}
+	return parts
+}
+
+var md5EtagRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Checks an ETag against the md5 of what was uploaded.
+// ETags that aren't an md5 (e.g. with server-side encryption) can't be checked, and are accepted.
+func checkUploadEtag(etag string, md5sum string) error {
+	etag = strings.ToLower(strings.Trim(etag, "\""))
+	if md5EtagRegex.MatchString(etag) && etag != md5sum {
+		return fmt.Errorf("uploaded data has md5 '%s', expected '%s'", etag, md5sum)
+	}
+	return nil
+}
+
+func getUploadStateFilename(name string) string {
+	dir, hasDir := os.LookupEnv("SHORELINE_UPLOAD_STATE_DIR")
+	if !hasDir || dir == "" {
+		dir = GetDotfilePath()
+	}
+	return filepath.Join(dir, ".tf_upload_"+name+".json")
+}
+
+// The saved upload of the same data, to resume, or a new one.
+func loadFileUpload(name string, md5sum string, size int64, partSize int64) *fileUpload {
+	nu := &fileUpload{Name: name, Md5: md5sum, Size: size, PartSize: partSize, Etags: map[int]string{}}
+	data, ok := ReadStringFromFile(getUploadStateFilename(name), "upload state", false)
+	if !ok {
+		return nu
+	}
+	saved := &fileUpload{}
+	if json.Unmarshal([]byte(data), saved) != nil || saved.UploadId == "" ||
+		saved.Md5 != md5sum || saved.Size != size || saved.PartSize != partSize {
+		return nu
+	}
+	if saved.Etags == nil {
+		saved.Etags = map[int]string{}
+	}
+	return saved
+}
+
+func (u *fileUpload) save() {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(getUploadStateFilename(u.Name), data, 0600); err != nil {
+		appendActionLog(fmt.Sprintf("Failed to save upload state of file object '%s': %s\n", u.Name, err.Error()))
+	}
+}
+
+func (u *fileUpload) remove() {
+	os.Remove(getUploadStateFilename(u.Name))
+}
+
+// PUTs a byte range of a file, returning the ETag after checking it against the range's md5.
+func putFileRange(ctx context.Context, file *os.File, offset int64, length int64, url string) (string, error) {
+	hash := md5.New()
+	body := io.TeeReader(io.NewSectionReader(file, offset, length), hash)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create upload request: %s", err.Error())
+	}
+	req.ContentLength = length
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return "", fmt.Errorf("upload failed with status %d (%s)", response.StatusCode, http.StatusText(response.StatusCode))
+	}
+	etag := response.Header.Get("ETag")
+	if err := checkUploadEtag(etag, fmt.Sprintf("%x", hash.Sum(nil))); err != nil {
+		return "", err
+	}
+	return strings.Trim(etag, "\""), nil
+}
+
+// Runs 'put' up to uploadAttempts times, backing off between attempts.
+func putWithRetry(ctx context.Context, what string, put func() (string, error)) (string, error) {
+	wait := pollIntervalMin
+	var err error
+	for attempt := 1; attempt <= uploadAttempts; attempt++ {
+		var etag string
+		etag, err = put()
+		if err == nil {
+			return etag, nil
+		}
+		appendActionLog(fmt.Sprintf("Upload of %s failed (attempt %d of %d): %s\n", what, attempt, uploadAttempts, err.Error()))
+		if attempt == uploadAttempts {
+			break
+		}
+		var cancelled bool
+		wait, cancelled = pollBackoff(ctx, wait)
+		if cancelled {
+			return "", fmt.Errorf("cancelled uploading %s: %s", what, err.Error())
+		}
+	}
+	return "", fmt.Errorf("failed to upload %s after %d attempts: %s", what, uploadAttempts, err.Error())
+}
+
+// Uploads the parts that aren't done yet (to the given urls), saving the state after each one.
+func (u *fileUpload) uploadParts(ctx context.Context, file *os.File, urls map[int]string) error {
+	parts := UploadParts(u.Size, u.PartSize)
+	done := int64(0)
+	for _, part := range parts {
+		if _, uploaded := u.Etags[part.Number]; uploaded {
+			done += part.Length
+		}
+	}
+	if done > 0 {
+		appendActionLog(fmt.Sprintf("Resuming upload of file object '%s' at %d%% (%d of %d bytes)\n", u.Name, done*100/u.Size, done, u.Size))
+	}
+	for _, part := range parts {
+		if _, uploaded := u.Etags[part.Number]; uploaded {
+			continue
+		}
+		url, hasUrl := urls[part.Number]
+		if !hasUrl {
+			return fmt.Errorf("no upload url for part %d", part.Number)
+		}
+		what := fmt.Sprintf("part %d of %d of file object '%s'", part.Number, len(parts), u.Name)
+		etag, err := putWithRetry(ctx, what, func() (string, error) {
+			return putFileRange(ctx, file, part.Offset, part.Length, url)
+		})
+		if err != nil {
+			return err
+		}
+		u.Etags[part.Number] = etag
+		u.save()
+		done += part.Length
+		appendActionLog(fmt.Sprintf("Uploaded %s: %d%% (%d of %d bytes)\n", what, done*100/u.Size, done, u.Size))
+	}
+	return nil
+}
+
+func startFileUploadOp(u *fileUpload) string {
+	op := fmt.Sprintf("%s( file_name = \"%s\", size = %d, part_size = %d", startFileUploadOpName, u.Name, u.Size, u.PartSize)
+	if u.UploadId != "" {
+		op += fmt.Sprintf(", upload_id = \"%s\"", EscapeString(u.UploadId))
+	}
+	return op + " )"
+}
+
+func completeFileUploadOp(u *fileUpload) string {
+	numbers := []int{}
+	for number, _ := range u.Etags {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	parts := []map[string]interface{}{}
+	for _, number := range numbers {
+		parts = append(parts, map[string]interface{}{"part_number": number, "etag": u.Etags[number]})
+	}
+	partsJs, _ := json.Marshal(parts)
+	return fmt.Sprintf("complete_file_upload( file_name = \"%s\", upload_id = \"%s\", parts = \"%s\" )", u.Name, EscapeString(u.UploadId), EscapeString(string(partsJs)))
+}
+
+// The upload id, and the url of each part, from start_file_upload.
+func ParseStartFileUpload(js map[string]interface{}) (string, map[int]string, error) {
+	uploadId := CastToString(GetNestedValueOrDefault(js, ToKeyPath("start_file_upload.upload_id"), ""))
+	if uploadId == "" {
+		return "", nil, fmt.Errorf("no upload_id in response")
+	}
+	urls := map[int]string{}
+	for _, part := range CastToArray(GetNestedValueOrDefault(js, ToKeyPath("start_file_upload.parts"), []interface{}{})) {
+		number, isNum := GetNestedValueOrDefault(part, ToKeyPath("part_number"), nil).(float64)
+		url := CastToString(GetNestedValueOrDefault(part, ToKeyPath("url"), ""))
+		if !isNum || url == "" {
+			return "", nil, fmt.Errorf("invalid part in response: %v", part)
+		}
+		urls[int(number)] = url
+	}
+	return uploadId, urls, nil
+}
+
+// Starts (or resumes) a multipart upload.
+func (u *fileUpload) start() (map[int]string, error) {
+	for {
+		js, err := runOpCommandToJson(startFileUploadOp(u))
+		var urls map[int]string
+		if err == nil {
+			var uploadId string
+			uploadId, urls, err = ParseStartFileUpload(js)
+			if err == nil {
+				u.UploadId = uploadId
+				u.save()
+				return urls, nil
+			}
+		}
+		if u.UploadId == "" {
+			return nil, fmt.Errorf("couldn't start upload: %s", err.Error())
+		}
+		// e.g. expired: start over
+		appendActionLog(fmt.Sprintf("Can't resume upload '%s' of file object '%s', restarting: %s\n", u.UploadId, u.Name, err.Error()))
+		u.UploadId = ""
+		u.Etags = map[int]string{}
+	}
+}
+
+// Checks the md5 of the stored object (from complete_file_upload) against the local one.
+func checkStoredMd5(result string, md5sum string) error {
+	js := map[string]interface{}{}
+	json.Unmarshal([]byte(result), &js)
+	stored := CastToString(GetNestedValueOrDefault(js, ToKeyPath("complete_file_upload.md5"), ""))
+	if stored == "" {
+		return fmt.Errorf("backend did not return an md5 for the stored object, so the upload can't be verified")
+	}
+	if stored != md5sum {
+		return fmt.Errorf("stored object has md5 '%s', expected '%s'", stored, md5sum)
+	}
+	return nil
+}
+
+// Uploads a multipart file object, and checks the stored object against the local md5.
+func uploadFileMultipart(ctx context.Context, name string, src string, md5sum string, size int64, partSize int64) error {
+	u := loadFileUpload(name, md5sum, size, partSize)
+	urls, err := u.start()
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("couldn't open local upload file '%s'", src)
+	}
+	defer file.Close()
+	if err := u.uploadParts(ctx, file, urls); err != nil {
+		return err
+	}
+
+	result, err := runOpCommand(completeFileUploadOp(u), true)
+	if err == nil {
+		err = CheckUpdateResult(result)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't complete upload: %s", err.Error())
+	}
+	// The completed upload can't be resumed, whatever the md5 check says. On a mismatch the
+	// stored object is bad as a whole (not in a known part), so the next apply intentionally
+	// starts a new upload from scratch.
+	u.remove()
+	if err := checkStoredMd5(result, md5sum); err != nil {
+		return err
+	}
+	appendActionLog(fmt.Sprintf("Uploaded file object '%s' (%d bytes, %d parts), md5 verified\n", name, size, len(u.Etags)))
+	return nil
+}
+
+// Uploads the data of a file object: in parts if large (and supported), else with a single PUT.
+func uploadFileObject(ctx context.Context, meta interface{}, name string, src string, md5sum string, size int64) error {
+	partSize := getUploadPartSize()
+	if size > partSize {
+		unsupported := checkOpSupported(meta, startFileUploadOpName, "Multipart file upload")
+		if unsupported == nil {
+			start := time.Now()
+			err := uploadFileMultipart(ctx, name, src, md5sum, size, partSize)
+			if err == nil {
+				appendActionLog(fmt.Sprintf("Upload of file object '%s' took %v\n", name, time.Since(start)))
+			}
+			return err
+		}
+		if size > uploadSinglePutMax {
+			return fmt.Errorf("file object '%s' is %d bytes, over the single upload limit of %d bytes: %s", name, size, int64(uploadSinglePutMax), unsupported.Error())
+		}
+		appendActionLog(fmt.Sprintf("Uploading file object '%s' with a single PUT: %s\n", name, unsupported.Error()))
+	}
+	presignedUrl := getRemoteFileAttr(name, "presigned_put")
+	if presignedUrl == "" {
+		return fmt.Errorf("failed to get presigned url")
+	}
+	file, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("couldn't open local upload file '%s'", src)
+	}
+	defer file.Close()
+	_, err = putWithRetry(ctx, fmt.Sprintf("file object '%s'", name), func() (string, error) {
+		etag, err := putFileRange(ctx, file, 0, size, presignedUrl)
+		if err == nil {
+			err = checkUploadEtag(etag, md5sum)
+		}
+		return etag, err
+	})
+	if err == nil {
+		appendActionLog(fmt.Sprintf("Uploaded file object '%s' (%d bytes)\n", name, size))
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+// Copyright 2021, Shoreline Software Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Declarative validation rules, from the attribute metadata in ObjectConfigJsonStr:
+//   "enum":   ["above", "below"]  -- one of the known values (others only warn, as the
+//                                    backend may accept values the provider doesn't know)
+//   "regex":  "^/"                -- matches the regular expression
+//   "min":    0, "max": 100       -- numeric bounds (inclusive)
+//   "length": [1, 64]             -- string length bounds (inclusive)
+//   "advisory": true              -- the other rules only warn too, for conventions the backend
+//                                    doesn't enforce (e.g. an absolute shell path)
+// For list attributes, the rules apply to each item.
+
+// Builds a validator from the attribute's rules, or nil if it has none.
+func attrMetaValidateFunc(attrMap map[string]interface{}) schema.SchemaValidateFunc {
+	validators := []schema.SchemaValidateFunc{}
+
+	enum, hasEnum := attrMap["enum"].([]interface{})
+	if hasEnum {
+		allowed := []string{}
+		for _, e := range enum {
+			allowed = append(allowed, CastToString(e))
+		}
+		validators = append(validators, func(val interface{}, key string) (warns []string, errs []error) {
+			v := CastToString(val)
+			for _, a := range allowed {
+				if v == a {
+					return
+				}
+			}
+			warns = append(warns, fmt.Sprintf("%q is usually one of (%s), got: '%+v' (passed to the backend as is)", key, strings.Join(allowed, ", "), val))
+			return
+		})
+	}
+
+	reStr, hasRegex := attrMap["regex"].(string)
+	if hasRegex {
+		re, err := regexp.Compile(reStr)
+		if err == nil {
+			validators = append(validators, func(val interface{}, key string) (warns []string, errs []error) {
+				if !re.MatchString(CastToString(val)) {
+					errs = append(errs, fmt.Errorf("%q must match the regex '%s', got: '%+v'", key, reStr, val))
+				}
+				return
+			})
+		}
+	}
+
+	min, hasMin := attrMap["min"].(float64)
+	max, hasMax := attrMap["max"].(float64)
+	if hasMin || hasMax {
+		validators = append(validators, func(val interface{}, key string) (warns []string, errs []error) {
+			v := CastToNumber(val)
+			if hasMin && v < min {
+				errs = append(errs, fmt.Errorf("%q must be >= %v, got: %v", key, min, val))
+			}
+			if hasMax && v > max {
+				errs = append(errs, fmt.Errorf("%q must be <= %v, got: %v", key, max, val))
+			}
+			return
+		})
+	}
+
+	length, hasLength := attrMap["length"].([]interface{})
+	if hasLength && len(length) == 2 {
+		minLen := int(CastToNumber(length[0]))
+		maxLen := int(CastToNumber(length[1]))
+		validators = append(validators, func(val interface{}, key string) (warns []string, errs []error) {
+			l := len(CastToString(val))
+			if l < minLen || l > maxLen {
+				errs = append(errs, fmt.Errorf("%q must be between %d and %d characters long, got: %d", key, minLen, maxLen, l))
+			}
+			return
+		})
+	}
+
+	validate := chainValidateFuncs(validators...)
+	if advisory, _ := attrMap["advisory"].(bool); advisory && validate != nil {
+		return func(val interface{}, key string) (warns []string, errs []error) {
+			warns, errs = validate(val, key)
+			for _, e := range errs {
+				warns = append(warns, e.Error()+" (passed to the backend as is)")
+			}
+			return warns, nil
+		}
+	}
+	return validate
+}
+
+// Combines validators (skipping nil ones), reporting the problems from all of them.
+func chainValidateFuncs(funcs ...schema.SchemaValidateFunc) schema.SchemaValidateFunc {
+	chain := []schema.SchemaValidateFunc{}
+	for _, f := range funcs {
+		if f != nil {
+			chain = append(chain, f)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	if len(chain) == 1 {
+		return chain[0]
+	}
+	return func(val interface{}, key string) (warns []string, errs []error) {
+		for _, f := range chain {
+			w, e := f(val, key)
+			warns = append(warns, w...)
+			errs = append(errs, e...)
+		}
+		return
+	}
+}
+
+// Checks the validation rules themselves.
+func validateAttrMetaRules(attrMap map[string]interface{}) error {
+	reStr, hasRegex := attrMap["regex"].(string)
+	if hasRegex {
+		_, err := regexp.Compile(reStr)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %s", err.Error())
+		}
+	}
+	length, hasLength := attrMap["length"].([]interface{})
+	if hasLength {
+		if len(length) != 2 {
+			return fmt.Errorf("length should be [min, max], got: %v", length)
+		}
+		for _, l := range length {
+			if _, isNum := l.(float64); !isNum {
+				return fmt.Errorf("length should be [min, max], got: %v", length)
+			}
+		}
+	}
+	min, hasMin := attrMap["min"].(float64)
+	max, hasMax := attrMap["max"].(float64)
+	if hasMin && hasMax && min > max {
+		return fmt.Errorf("min (%v) is greater than max (%v)", min, max)
+	}
+	return nil
+}
+
+func ValidateTimestamp(val interface{}, key string) (warns []string, errs []error) {
+	_, err := time.Parse(time.RFC3339, CastToString(val))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%q must be an RFC3339 timestamp (e.g. 2021-06-30T22:00:00Z),\n but got: %s", key, CastToString(val)))
+	}
+	return
+}